@@ -19,6 +19,7 @@ import (
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
+	"github.com/robrohan/legendary-doodle/internals/blobstore"
 	"github.com/robrohan/legendary-doodle/internals/handlers"
 	"github.com/robrohan/legendary-doodle/internals/models"
 	"github.com/robrohan/legendary-doodle/internals/repository"
@@ -57,6 +58,9 @@ func run() error {
 		}
 		return errors.Wrap(err, "parsing config")
 	}
+	if strings.TrimSpace(cfg.Share.Secret) == "" {
+		return errors.New("parsing config: WB_SHARE_SECRET must be set to sign shared links")
+	}
 
 	var endpoint = oauth2.Endpoint{
 		AuthURL:   cfg.Auth.AuthURL,
@@ -117,6 +121,15 @@ func run() error {
 	// Put the API on top of the connection
 	repo := repository.Attach(cfg.Base.Root, db, cfg.DB.Driver)
 
+	// =========================================================================
+	// Start Blob Store
+	log.Printf("Initializing %s blob store", cfg.Blobs.Store)
+
+	blobs, err := blobstore.Open(cfg.Blobs.Store, cfg.Blobs.Root, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// =========================================================================
 	// Setup template handling
 	templates := handlers.TemplateInit()
@@ -135,6 +148,7 @@ func run() error {
 
 	env := &models.Env{
 		Db:        db,
+		Blobs:     blobs,
 		Log:       log,
 		Router:    router,
 		Cfg:       &cfg,
@@ -161,9 +175,20 @@ func run() error {
 		router.HandleFunc("/callback", handleCallback(env, oauthConfig, repo)).Methods("GET")
 		/////////////////////////
 		router.HandleFunc("/download", handlers.ServeMidiDownload(env, templates)).Methods("GET")
+		router.HandleFunc("/api/v1/generate", handlers.ServeGenerate(env)).Methods("POST")
+		/////////////////////////
+		// Shared ideas, no login needed
+		router.HandleFunc("/s/{token}", handlers.ServeSharePage(env, templates, repo)).Methods("GET")
+		router.HandleFunc("/s/{token}/download", handlers.ServeShareDownload(env, repo)).Methods("GET")
 		/////////////////////////
 		// Secure pages... "the app"
 		secure.HandleFunc("/home", handlers.ServePage(env, templates)).Methods("GET")
+		secure.HandleFunc("/library", handlers.ServeLibrary(env, templates, repo)).Methods("GET")
+		secure.HandleFunc("/library", handlers.ServeSaveIdea(env, repo)).Methods("POST")
+		secure.HandleFunc("/library/{id}", handlers.ServeIdeaDownload(env, repo)).Methods("GET")
+		secure.HandleFunc("/library/{id}/delete", handlers.ServeDeleteIdea(env, repo)).Methods("POST")
+		secure.HandleFunc("/library/{id}/share", handlers.ServeCreateShare(env, repo)).Methods("POST")
+		secure.HandleFunc("/shares/{token}/revoke", handlers.ServeRevokeShare(env, repo)).Methods("POST")
 	}
 
 	api := http.Server{
@@ -301,8 +326,8 @@ func LoginVerify(env *models.Env, repo *repository.DataRepository) mux.Middlewar
 				return
 			}
 
-			// Ok, not thing wrong, move on
-			next.ServeHTTP(w, r)
+			// Ok, not thing wrong, move on with the user in the context
+			next.ServeHTTP(w, r.WithContext(models.WithUser(r.Context(), user)))
 		})
 	}
 }
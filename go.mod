@@ -3,7 +3,6 @@ module github.com/robrohan/legendary-doodle
 go 1.18
 
 require (
-	github.com/aquilax/go-perlin v1.1.0
 	github.com/ardanlabs/conf v1.3.3
 	github.com/google/uuid v1.0.0
 	github.com/gorilla/mux v1.8.0
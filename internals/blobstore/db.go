@@ -0,0 +1,91 @@
+package blobstore
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DB what a DBStore needs from the database
+type DB interface {
+	Preparex(query string) (*sqlx.Stmt, error)
+}
+
+// DBStore keeps blobs in the blobs table of the database
+type DBStore struct {
+	putQuery *sqlx.Stmt
+	getQuery *sqlx.Stmt
+	hasQuery *sqlx.Stmt
+}
+
+// NewDBStore a store in the blobs table of db
+func NewDBStore(db DB) (*DBStore, error) {
+	if db == nil {
+		return nil, errors.New("no database for the blob store")
+	}
+
+	var s DBStore
+	var err error
+	s.putQuery, err = db.Preparex(`
+		INSERT INTO blobs (hash, data, size, created)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (hash) DO NOTHING
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	s.getQuery, err = db.Preparex(`
+		SELECT data
+		FROM blobs
+		WHERE hash = $1
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	s.hasQuery, err = db.Preparex(`
+		SELECT count(*)
+		FROM blobs
+		WHERE hash = $1
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (s *DBStore) Put(data []byte) (string, error) {
+	hash := Hash(data)
+	_, err := s.putQuery.Exec(hash, data, len(data), time.Now().UTC())
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (s *DBStore) Get(hash string) ([]byte, error) {
+	if err := checkHash(hash); err != nil {
+		return nil, err
+	}
+	var data []byte
+	err := s.getQuery.QueryRowx(hash).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *DBStore) Has(hash string) (bool, error) {
+	if err := checkHash(hash); err != nil {
+		return false, err
+	}
+	var n int
+	if err := s.hasQuery.QueryRowx(hash).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
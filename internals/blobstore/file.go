@@ -0,0 +1,81 @@
+package blobstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps blobs as files under a directory, in sub directories
+// named after the first two characters of their hash so no one directory
+// gets too big
+type FileStore struct {
+	Root string
+}
+
+// NewFileStore a store rooted in the directory root, which is made if it
+// isn't there
+func NewFileStore(root string) (*FileStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FileStore{Root: root}, nil
+}
+
+func (s *FileStore) path(hash string) string {
+	return filepath.Join(s.Root, hash[:2], hash)
+}
+
+func (s *FileStore) Put(data []byte) (string, error) {
+	hash := Hash(data)
+	if ok, err := s.Has(hash); err != nil || ok {
+		return hash, err
+	}
+
+	path := s.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	// written to a temp file and then moved into place, so a half written
+	// blob is never seen under its hash
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+func (s *FileStore) Get(hash string) ([]byte, error) {
+	if err := checkHash(hash); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *FileStore) Has(hash string) (bool, error) {
+	if err := checkHash(hash); err != nil {
+		return false, err
+	}
+	_, err := os.Stat(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,54 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound there is no blob with the hash asked for
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs by the SHA-256 of their bytes, so the same bytes are
+// only ever stored once however many times they are put
+type Store interface {
+	// Put stores the bytes if they aren't already, and returns their hash
+	Put(data []byte) (string, error)
+	// Get the bytes with a hash, or ErrNotFound
+	Get(hash string) ([]byte, error)
+	// Has true if there are bytes stored with the hash
+	Has(hash string) (bool, error)
+}
+
+// Hash the key of some bytes in a store, the SHA-256 of them as hex
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkHash makes sure a hash is 64 lower case hex characters, so it is
+// safe to use in a path
+func checkHash(hash string) error {
+	if len(hash) != sha256.Size*2 {
+		return fmt.Errorf("bad blob hash: %v", hash)
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return fmt.Errorf("bad blob hash: %v", hash)
+		}
+	}
+	return nil
+}
+
+// Open a store by its kind, "file" for one rooted in a directory or "db"
+// for one in the blobs table of the database
+func Open(kind string, root string, db DB) (Store, error) {
+	switch kind {
+	case "file", "":
+		return NewFileStore(root)
+	case "db":
+		return NewDBStore(db)
+	}
+	return nil, fmt.Errorf("unknown blob store: %v", kind)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/robrohan/legendary-doodle/internals/models"
+	"github.com/robrohan/legendary-doodle/internals/songmatic"
+)
+
+// most a generate request body can be
+const maxSpecBytes = 64 * 1024
+
+// generateSpec what to make, posted as JSON to /api/v1/generate. Anything
+// left out gets the same default it does on /download. The seed can be a
+// number or a string, as seeds are often too big for a javascript number
+type generateSpec struct {
+	Key   string      `json:"key"`
+	Mode  string      `json:"mode"`
+	Tempo *int        `json:"tempo"`
+	Meter string      `json:"meter"`
+	Bars  *int        `json:"bars"`
+	Parts []string    `json:"parts"`
+	Style string      `json:"style"`
+	Seed  json.Number `json:"seed"`
+	// any of the other /download fields, like "prog", "bass" or "swing"
+	Options map[string]string `json:"options"`
+}
+
+// values the spec as /download fields
+func (s generateSpec) values() url.Values {
+	values := url.Values{}
+	for name, value := range s.Options {
+		values.Set(name, value)
+	}
+	set := func(name string, value string) {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	set("key", s.Key)
+	set("mode", s.Mode)
+	set("meter", s.Meter)
+	set("style", s.Style)
+	set("seed", s.Seed.String())
+	// numbers are pointers so a 0 that was sent is checked, not dropped
+	if s.Tempo != nil {
+		values.Set("tempo", fmt.Sprintf("%v", *s.Tempo))
+	}
+	if s.Bars != nil {
+		values.Set("bars", fmt.Sprintf("%v", *s.Bars))
+	}
+	// the parts say what to make
+	values.Del("type")
+	return values
+}
+
+// generatedPart the midi file of one part, which is base64 in the JSON
+type generatedPart struct {
+	Part string `json:"part"`
+	Midi []byte `json:"midi"`
+}
+
+// generateResponse what was made, so it can be shown as well as played
+type generateResponse struct {
+	Seed        string            `json:"seed"`
+	Key         string            `json:"key"`
+	Mode        string            `json:"mode"`
+	Tempo       float64           `json:"tempo"`
+	Meter       string            `json:"meter"`
+	Bars        int               `json:"bars"`
+	Style       string            `json:"style"`
+	Scale       []string          `json:"scale"`
+	Progression string            `json:"progression"`
+	Chords      []string          `json:"chords"`
+	Defaults    map[string]string `json:"defaults"`
+	Parts       []generatedPart   `json:"parts"`
+}
+
+// the parts made when a spec doesn't ask for any
+var defaultParts = []string{"chords", "drums", "bass", "melody"}
+
+// ServeGenerate makes the parts asked for in a JSON spec, and sends them back
+// with the seed, scale and chords that were used
+func ServeGenerate(env *models.Env) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var spec generateSpec
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSpecBytes))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&spec); err != nil {
+			writeFieldErrors(w, []fieldError{{"body", "", err.Error()}})
+			return
+		}
+
+		names := spec.Parts
+		if len(names) == 0 {
+			names = defaultParts
+		}
+		var invalid []fieldError
+		parts := make([]songmatic.Part, 0, len(names))
+		for _, name := range names {
+			part, err := songmatic.ParsePart(name)
+			if err != nil {
+				invalid = append(invalid, fieldError{"parts", name, err.Error()})
+				continue
+			}
+			parts = append(parts, part)
+		}
+
+		values := spec.values()
+		req, bad := parseIdeaRequest(values)
+		invalid = append(invalid, bad...)
+		if len(invalid) > 0 {
+			log.Printf("Bunk fields given in spec: %v", invalid)
+			writeFieldErrors(w, invalid)
+			return
+		}
+
+		idea := req.Idea
+		res := generateResponse{
+			Seed:        fmt.Sprintf("%v", req.Gen.Seed),
+			Key:         req.Key,
+			Mode:        idea.Scale.Mode.String(),
+			Tempo:       idea.Tempo,
+			Meter:       idea.Meter.String(),
+			Bars:        idea.Bars,
+			Style:       idea.Drums.Name,
+			Progression: idea.Progression.Numerals(idea.Scale),
+			Chords:      idea.Progression.Symbols(idea.Scale),
+			Defaults:    req.Defaults,
+		}
+		// the parts say what was made, not the type
+		delete(res.Defaults, "type")
+		// the scale the melody was picked from, which is the key's unless
+		// the options asked for another
+		scale := idea.Scale
+		if len(idea.MelodyScale.Notes) > 0 {
+			scale = idea.MelodyScale
+		}
+		for _, n := range scale.Notes {
+			res.Scale = append(res.Scale, n.Name())
+		}
+
+		// every part is made the same way /download makes it, from a new
+		// generator on the same seed, so each can be fetched again there
+		values.Set("seed", res.Seed)
+		for _, part := range parts {
+			values.Set("type", part.String())
+			partReq, _ := parseIdeaRequest(values)
+			res.Parts = append(res.Parts, generatedPart{
+				Part: part.String(),
+				Midi: partReq.Gen.Generate(part, partReq.Idea),
+			})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			log.Printf("Could not write generate response: %v", err)
+		}
+	}
+}
@@ -4,14 +4,11 @@ import (
 	"fmt"
 	"html/template"
 	"log"
-	"math/rand"
 	"net/http"
 	"os"
 	"regexp"
-	"strconv"
 
 	"github.com/robrohan/legendary-doodle/internals/models"
-	"github.com/robrohan/legendary-doodle/internals/songmatic"
 )
 
 type pageData struct {
@@ -62,66 +59,26 @@ func ServePage(env *models.Env, t *template.Template) http.HandlerFunc {
 }
 
 func ServeMidiDownload(env *models.Env, t *template.Template) http.HandlerFunc {
-	songmatic.Alloc()
 	return func(w http.ResponseWriter, r *http.Request) {
-
-		frmKey := r.URL.Query().Get("key")
-		frmTempo := r.URL.Query().Get("tempo")
-		frmType := r.URL.Query().Get("type")
-		frmBars := r.URL.Query().Get("bars")
-
-		key, err := strconv.Atoi(frmKey)
-		if err != nil {
-			log.Printf("Bunk key given in form: %v", frmKey)
-			max := 12
-			min := 0
-			v := rand.Intn(max-min) + min
-			key = v
-		}
-
-		tempoI, err := strconv.Atoi(frmTempo)
-		if err != nil {
-			log.Printf("Bunk key given in form: %v", frmTempo)
-			tempoI = int(songmatic.GenerateTempo())
-		}
-
-		genType, err := strconv.Atoi(frmType)
-		if err != nil {
-			log.Printf("Bunk type given in form: %v", frmType)
-			tempoI = int(songmatic.GenerateTempo())
-		}
-
-		bars, err := strconv.Atoi(frmBars)
-		if err != nil {
-			log.Printf("Bunk bars given in form: %v", frmBars)
-			tempoI = int(songmatic.GenerateTempo())
-		}
-
-		tempo := float64(tempoI)
-		scale := songmatic.GenerateScale(key)
-		jazz := false
-
-		var genSlice []byte
-		fname := "chords"
-		switch genType {
-		case 0:
-			genSlice = songmatic.RandomChords(tempo, scale, bars, jazz)
-			fname = "chords"
-		case 1:
-			genSlice = songmatic.RandomBeat(tempo, scale, bars)
-			fname = "drums"
-		case 2:
-			genSlice = songmatic.RandomBass(tempo, scale, bars)
-			fname = "bass"
-		case 3:
-			genSlice = songmatic.RandomMelody(tempo, scale, bars)
-			fname = "melody"
+		req, invalid := parseIdeaRequest(r.URL.Query())
+		if len(invalid) > 0 {
+			log.Printf("Bunk fields given in form: %v", invalid)
+			writeFieldErrors(w, invalid)
+			return
 		}
-
-		fileName := fmt.Sprintf("%s_%v_%s.midi", fname, tempo, scale.Notes[0])
-		w.Header().Set("Content-Type", "audio/midi")
-		w.Header().Set("Content-Disposition", "inline; filename="+fileName)
-		w.Header().Set("Content-Length", fmt.Sprintf("%v", len(genSlice)))
-		w.Write(genSlice)
+		writeMidi(w, req, req.Gen.Generate(req.Part, req.Idea))
 	}
 }
+
+// writeMidi sends back the midi file made for a request
+func writeMidi(w http.ResponseWriter, req ideaRequest, genSlice []byte) {
+	idea, part := req.Idea, req.Part
+	fname := part.String()
+
+	fileName := fmt.Sprintf("%s_%v_%s.midi", fname, idea.Tempo, idea.Scale.Notes[0].Name())
+	w.Header().Set("Content-Type", "audio/midi")
+	req.headers(w.Header())
+	w.Header().Set("Content-Disposition", "inline; filename="+fileName)
+	w.Header().Set("Content-Length", fmt.Sprintf("%v", len(genSlice)))
+	w.Write(genSlice)
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/robrohan/legendary-doodle/internals/models"
+	"github.com/robrohan/legendary-doodle/internals/repository"
+)
+
+// libraryIdea a saved idea with what it makes, for showing in the library
+type libraryIdea struct {
+	models.Idea
+	Part        string
+	Key         string
+	Tempo       float64
+	Bars        int
+	Progression string
+	Shares      []shareLink
+}
+
+type libraryPage struct {
+	pageData
+	Ideas []libraryIdea
+}
+
+// savedRequest reads the spec of a saved idea back into a request
+func savedRequest(idea *models.Idea) (ideaRequest, error) {
+	values, err := url.ParseQuery(idea.Spec)
+	if err != nil {
+		return ideaRequest{}, err
+	}
+	req, invalid := parseIdeaRequest(values)
+	if len(invalid) > 0 {
+		return ideaRequest{}, fmt.Errorf("bunk fields in saved idea: %v", invalid)
+	}
+	return req, nil
+}
+
+// ServeLibrary lists the ideas the logged in user has saved
+func ServeLibrary(env *models.Env, t *template.Template, repo *repository.DataRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := models.UserFrom(r.Context())
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+			return
+		}
+
+		saved, err := repo.ListIdeas(user.UUID)
+		if err != nil {
+			env.Log.Printf("Could not list ideas: %v", err)
+			http.Error(w, "Could not list ideas", http.StatusInternalServerError)
+			return
+		}
+
+		shares, err := repo.ListShares(user.UUID)
+		if err != nil {
+			env.Log.Printf("Could not list shares: %v", err)
+			http.Error(w, "Could not list ideas", http.StatusInternalServerError)
+			return
+		}
+		links := map[string][]shareLink{}
+		now := time.Now()
+		for _, share := range shares {
+			if share.Live(now) {
+				token := shareToken(env.Cfg.Share.Secret, share.Token)
+				links[share.Idea] = append(links[share.Idea], shareLink{token, share.Expires})
+			}
+		}
+
+		pd := libraryPage{
+			pageData: pageData{
+				"Songmatic Library",
+				"Songmatic Template",
+			},
+		}
+		for _, idea := range saved {
+			req, err := savedRequest(&idea)
+			if err != nil {
+				env.Log.Printf("Could not read idea %v: %v", idea.UUID, err)
+				continue
+			}
+			pd.Ideas = append(pd.Ideas, libraryIdea{
+				Idea:        idea,
+				Part:        req.Part.String(),
+				Key:         req.Key,
+				Tempo:       req.Idea.Tempo,
+				Bars:        req.Idea.Bars,
+				Progression: req.Idea.Progression.Numerals(req.Idea.Scale),
+				Shares:      links[idea.UUID],
+			})
+		}
+
+		w.WriteHeader(200)
+		t.ExecuteTemplate(w, "library.html", pd)
+	}
+}
+
+// ServeSaveIdea saves the idea in a posted form to the logged in user's
+// library. The seed is saved with it, so it can be made again note for note
+func ServeSaveIdea(env *models.Env, repo *repository.DataRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := models.UserFrom(r.Context())
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			writeFieldErrors(w, []fieldError{{"body", "", err.Error()}})
+			return
+		}
+		name := strings.TrimSpace(r.PostForm.Get("name"))
+
+		// only keep the fields that were given, and the seed they used
+		values := url.Values{}
+		for field := range r.Form {
+			if v := strings.TrimSpace(r.Form.Get(field)); v != "" && field != "name" {
+				values.Set(field, v)
+			}
+		}
+		req, invalid := parseIdeaRequest(values)
+		if len(invalid) > 0 {
+			log.Printf("Bunk fields given in form: %v", invalid)
+			writeFieldErrors(w, invalid)
+			return
+		}
+		values.Set("seed", fmt.Sprintf("%v", req.Gen.Seed))
+
+		if name == "" {
+			name = fmt.Sprintf("%s in %s", req.Part, req.Key)
+		}
+		// the midi is kept as it is now, so it can still be played after the
+		// generator changes
+		blob, err := env.Blobs.Put(req.Gen.Generate(req.Part, req.Idea))
+		if err != nil {
+			env.Log.Printf("Could not store idea: %v", err)
+			http.Error(w, "Could not save idea", http.StatusInternalServerError)
+			return
+		}
+
+		idea := models.NewIdea(user.UUID, name, values.Encode(), req.Gen.Seed, blob)
+		if err := repo.SaveIdea(idea); err != nil {
+			env.Log.Printf("Could not save idea: %v", err)
+			http.Error(w, "Could not save idea", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/-/library", http.StatusSeeOther)
+	}
+}
+
+// ServeIdeaDownload sends back the midi file of one of the logged in user's
+// saved ideas. Ideas saved before there was a blob store are made again
+func ServeIdeaDownload(env *models.Env, repo *repository.DataRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := models.UserFrom(r.Context())
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+			return
+		}
+
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		idea, err := repo.GetIdea(user.UUID, id)
+		if err != nil {
+			env.Log.Printf("Could not get idea %v: %v", id, err)
+			http.NotFound(w, r)
+			return
+		}
+
+		req, err := savedRequest(idea)
+		if err != nil {
+			env.Log.Printf("Could not read idea %v: %v", id, err)
+			http.Error(w, "Could not read idea", http.StatusInternalServerError)
+			return
+		}
+		if idea.Blob != nil && *idea.Blob != "" {
+			data, err := env.Blobs.Get(*idea.Blob)
+			if err == nil {
+				writeMidi(w, req, data)
+				return
+			}
+			env.Log.Printf("Could not get blob %v for idea %v: %v", *idea.Blob, id, err)
+		}
+		writeMidi(w, req, req.Gen.Generate(req.Part, req.Idea))
+	}
+}
+
+// ServeDeleteIdea removes one of the logged in user's saved ideas
+func ServeDeleteIdea(env *models.Env, repo *repository.DataRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := models.UserFrom(r.Context())
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+			return
+		}
+
+		id, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := repo.DeleteIdea(user.UUID, id); err != nil {
+			env.Log.Printf("Could not delete idea %v: %v", id, err)
+			http.NotFound(w, r)
+			return
+		}
+
+		http.Redirect(w, r, "/-/library", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/robrohan/legendary-doodle/internals/songmatic"
+)
+
+// Limits on what can be asked for
+const (
+	minBars  = 1
+	maxBars  = 64
+	minTempo = 20
+	maxTempo = 300
+
+	defaultBars = 4
+)
+
+// fieldError a field of a request that can't be used, and why
+type fieldError struct {
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+// errorResponse the body sent back with a 400
+type errorResponse struct {
+	Error  string       `json:"error"`
+	Fields []fieldError `json:"fields"`
+}
+
+// writeFieldErrors sends back a 400 listing every bad field
+func writeFieldErrors(w http.ResponseWriter, fields []fieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(errorResponse{"invalid parameters", fields})
+}
+
+// query reads the fields of a request. Fields that are left out keep their
+// default, and bad fields are all kept so they can be sent back together
+type query struct {
+	values  url.Values
+	invalid []fieldError
+	// the fields that were left out, in the order they were read
+	defaulted []string
+}
+
+// field reads one field with parse. Returns false if it was left out
+func (q *query) field(name string, parse func(string) error) bool {
+	v := strings.TrimSpace(q.values.Get(name))
+	if v == "" {
+		q.defaulted = append(q.defaulted, name)
+		return false
+	}
+	if err := parse(v); err != nil {
+		q.invalid = append(q.invalid, fieldError{name, v, err.Error()})
+	}
+	return true
+}
+
+// number reads a whole number field that has to be between lo and hi.
+// Returns false if it was left out
+func (q *query) number(name string, n *int, lo int, hi int) bool {
+	return q.field(name, func(v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < lo || i > hi {
+			return fmt.Errorf("must be a number from %d to %d", lo, hi)
+		}
+		*n = i
+		return nil
+	})
+}
+
+// ideaRequest everything needed to generate an idea, read from a request
+type ideaRequest struct {
+	Part songmatic.Part
+	Gen  *songmatic.Generator
+	Idea songmatic.Idea
+	// the name of the key, like "F#m"
+	Key string
+	// the value each field that was left out ended up with
+	Defaults map[string]string
+}
+
+// headerSpelling spells the chord qualities in numerals with ASCII, as
+// header values are read as Latin-1. "vii°" becomes "viio" and "viiø7"
+// becomes "viih7", which can both be given back as the prog field
+var headerSpelling = strings.NewReplacer("°", "o", "ø", "h")
+
+// headers adds the seed, the progression and the value of every field that
+// was left out to the response headers
+func (req ideaRequest) headers(h http.Header) {
+	h.Set("X-Songmatic-Seed", fmt.Sprintf("%v", req.Gen.Seed))
+	h.Set("X-Songmatic-Progression", headerSpelling.Replace(req.Idea.Progression.Numerals(req.Idea.Scale)))
+	for name, value := range req.Defaults {
+		h.Set("X-Songmatic-"+name, headerSpelling.Replace(value))
+	}
+}
+
+// parseIdeaRequest reads and checks all the fields of an idea. Returns the
+// fields that are bad if there are any.
+//
+// Fields left out of a request (or left empty) get a default. The key, tempo
+// and progression are rolled from the seed when they are left out, so the
+// same seed always gives the same idea. The value every left out field ended
+// up with is sent back in an X-Songmatic-<Field> header
+//
+//	type         chords
+//	seed         a new one every request
+//	key          a major key from the seed
+//	mode         ionian (aeolian for a minor key)
+//	tempo        from the seed
+//	bars         4
+//	meter        4/4
+//	swing        straight
+//	prog         from the seed
+//	perbar       1
+//	complexity   triads
+//	jazz         off
+//	voicing      piano
+//	arp          up
+//	rate         16
+//	octaves      1
+//	bass         root
+//	style        basic
+//	phrase       4
+//	melody       motif
+//	scale        the scale of the key
+//	range        60-84
+//	articulation detached
+//	humanize     0
+func parseIdeaRequest(values url.Values) (ideaRequest, []fieldError) {
+	q := &query{values: values}
+	var req ideaRequest
+
+	seed := songmatic.NewSeed()
+	q.field("seed", func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("must be a whole number")
+		}
+		seed = n
+		return nil
+	})
+	gen := songmatic.NewGenerator(seed)
+
+	part := songmatic.PartChords
+	q.field("type", func(v string) (err error) {
+		part, err = songmatic.ParsePart(v)
+		return err
+	})
+
+	key, minor := 0, false
+	if !q.field("key", func(v string) (err error) {
+		key, minor, err = songmatic.ParseKey(v)
+		return err
+	}) {
+		key = int(gen.RandMidiRange(0, len(songmatic.KeySignatures())))
+	}
+
+	tempo := 0
+	if !q.number("tempo", &tempo, minTempo, maxTempo) {
+		tempo = int(gen.GenerateTempo())
+	}
+
+	bars := defaultBars
+	q.number("bars", &bars, minBars, maxBars)
+
+	mode := songmatic.Ionian
+	q.field("mode", func(v string) (err error) {
+		mode, err = songmatic.ParseMode(v)
+		if err == nil && minor && mode != songmatic.Aeolian {
+			err = fmt.Errorf("a minor key is always aeolian, give the key as a major key to use %v", mode)
+		}
+		return err
+	})
+	// a minor key is the relative major played in Aeolian
+	if minor {
+		mode = songmatic.Aeolian
+	}
+
+	scale, err := songmatic.GenerateScale(key, mode)
+	if err != nil {
+		q.invalid = append(q.invalid, fieldError{"key", values.Get("key"), err.Error()})
+		scale, _ = songmatic.GenerateScale(0, mode)
+	}
+
+	meter := songmatic.Meter44
+	q.field("meter", func(v string) (err error) {
+		meter, err = songmatic.ParseMeter(v)
+		return err
+	})
+
+	swing := songmatic.Straight
+	q.field("swing", func(v string) (err error) {
+		swing, err = songmatic.ParseSwing(v)
+		return err
+	})
+
+	jazz := false
+	q.field("jazz", func(v string) error {
+		switch strings.ToLower(v) {
+		case "on", "true", "1":
+			jazz = true
+		case "off", "false", "0":
+			jazz = false
+		default:
+			return fmt.Errorf("must be on or off")
+		}
+		return nil
+	})
+
+	perBar := 1
+	q.field("perbar", func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || (n != 1 && n != 2 && n != 4) {
+			return fmt.Errorf("must be 1, 2 or 4")
+		}
+		perBar = n
+		return nil
+	})
+
+	var prog songmatic.Progression
+	q.field("prog", func(v string) (err error) {
+		prog, err = songmatic.ParseProgression(v, perBar)
+		return err
+	})
+	if len(prog.Chords) == 0 {
+		prog = gen.RandomProgression(perBar, jazz)
+	}
+
+	complexity := songmatic.ComplexityTriads
+	q.field("complexity", func(v string) (err error) {
+		complexity, err = songmatic.ParseComplexity(v)
+		return err
+	})
+	prog = gen.Complicate(scale, prog, complexity)
+
+	voicing := songmatic.VoicingPiano
+	q.field("voicing", func(v string) (err error) {
+		voicing, err = songmatic.ParseVoicingStyle(v)
+		return err
+	})
+
+	arp := songmatic.Arpeggio{Direction: songmatic.ArpUp, Rate: songmatic.Arp16th, Octaves: 1}
+	q.field("arp", func(v string) (err error) {
+		arp.Direction, err = songmatic.ParseArpDirection(v)
+		return err
+	})
+	q.field("rate", func(v string) (err error) {
+		arp.Rate, err = songmatic.ParseArpRate(v)
+		return err
+	})
+	q.number("octaves", &arp.Octaves, 1, 4)
+	if arp.Direction == songmatic.ArpPattern && !q.field("pattern", func(v string) (err error) {
+		arp.Pattern, err = songmatic.ParseArpPattern(v)
+		return err
+	}) {
+		q.invalid = append(q.invalid, fieldError{"pattern", "", "a pattern is needed for the pattern arpeggio"})
+	}
+
+	bass := songmatic.BassRoot
+	q.field("bass", func(v string) (err error) {
+		bass, err = songmatic.ParseBassStyle(v)
+		return err
+	})
+
+	drums, _ := songmatic.ParseDrumStyle("")
+	q.field("style", func(v string) (err error) {
+		drums, err = songmatic.ParseDrumStyle(v)
+		return err
+	})
+
+	phrase := 4
+	q.field("phrase", func(v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || (n != 4 && n != 8) {
+			return fmt.Errorf("must be 4 or 8")
+		}
+		phrase = n
+		return nil
+	})
+
+	melody := songmatic.MelodyMotif
+	q.field("melody", func(v string) (err error) {
+		melody, err = songmatic.ParseMelodyStyle(v)
+		return err
+	})
+
+	// melody and bass can use a scale other than the key's, on the
+	// same tonic
+	var melodyScale songmatic.Scale
+	q.field("scale", func(v string) error {
+		formula, err := songmatic.ParseScaleFormula(v)
+		if err != nil {
+			return err
+		}
+		melodyScale, err = songmatic.NewScale(scale.Notes[0], formula)
+		return err
+	})
+
+	melodyRange := songmatic.DefaultMelodyRange
+	q.field("range", func(v string) (err error) {
+		melodyRange, err = songmatic.ParseMelodyRange(v)
+		return err
+	})
+
+	articulation := songmatic.Detached
+	q.field("articulation", func(v string) (err error) {
+		articulation, err = songmatic.ParseArticulation(v)
+		return err
+	})
+
+	// humanize is a percentage for every part, which can be changed
+	// for one part with humanize_drums, humanize_bass, etc.
+	amount := 0
+	q.number("humanize", &amount, 0, 100)
+	humanize := map[songmatic.Part]songmatic.Humanize{}
+	for _, p := range []songmatic.Part{
+		songmatic.PartChords, songmatic.PartDrums, songmatic.PartBass, songmatic.PartMelody, songmatic.PartArp,
+	} {
+		partAmount := amount
+		if values.Get("humanize_"+p.String()) != "" {
+			q.number("humanize_"+p.String(), &partAmount, 0, 100)
+		}
+		humanize[p] = songmatic.DefaultHumanize(float64(partAmount) / 100)
+	}
+
+	if len(q.invalid) > 0 {
+		return req, q.invalid
+	}
+
+	req.Part = part
+	req.Gen = gen
+	req.Idea = songmatic.Idea{
+		Tempo:        float64(tempo),
+		Scale:        scale,
+		Meter:        meter,
+		Swing:        swing,
+		Bars:         bars,
+		Phrase:       phrase,
+		Progression:  prog,
+		Voicing:      voicing,
+		Arp:          arp,
+		Jazz:         jazz,
+		Bass:         bass,
+		Drums:        drums,
+		Melody:       melody,
+		MelodyRange:  melodyRange,
+		MelodyScale:  melodyScale,
+		Articulation: articulation,
+		Humanize:     humanize,
+	}
+
+	req.Key = songmatic.KeySignatures()[key].Major
+	if minor {
+		req.Key = songmatic.KeySignatures()[key].Minor
+	}
+	resolved := map[string]string{
+		"type":         req.Part.String(),
+		"seed":         fmt.Sprintf("%v", seed),
+		"key":          req.Key,
+		"mode":         mode.String(),
+		"tempo":        fmt.Sprintf("%v", tempo),
+		"bars":         fmt.Sprintf("%v", bars),
+		"meter":        meter.String(),
+		"swing":        swing.String(),
+		"prog":         prog.Numerals(scale),
+		"perbar":       fmt.Sprintf("%v", perBar),
+		"complexity":   complexity.String(),
+		"jazz":         fmt.Sprintf("%v", jazz),
+		"voicing":      voicing.String(),
+		"arp":          arp.Direction.String(),
+		"rate":         arp.Rate.String(),
+		"octaves":      fmt.Sprintf("%v", arp.Octaves),
+		"bass":         bass.String(),
+		"style":        drums.Name,
+		"phrase":       fmt.Sprintf("%v", phrase),
+		"melody":       melody.String(),
+		"scale":        "key",
+		"range":        melodyRange.String(),
+		"articulation": articulation.String(),
+		"humanize":     fmt.Sprintf("%v", amount),
+	}
+	req.Defaults = map[string]string{}
+	for _, name := range q.defaulted {
+		if value, ok := resolved[name]; ok {
+			req.Defaults[name] = value
+		}
+	}
+	return req, nil
+}
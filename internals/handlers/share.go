@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/robrohan/legendary-doodle/internals/models"
+	"github.com/robrohan/legendary-doodle/internals/repository"
+)
+
+// longest a public link can last
+const maxShareDays = 365
+
+// shareLink a public link to show in the library
+type shareLink struct {
+	Token   string
+	Expires *time.Time
+}
+
+type sharePage struct {
+	pageData
+	Token       string
+	Name        string
+	Part        string
+	Key         string
+	Meter       string
+	Tempo       float64
+	Bars        int
+	Progression string
+	Chords      []string
+	Expires     *time.Time
+}
+
+// newShareID a random id for a public link, too long to guess
+func newShareID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(id), nil
+}
+
+func signShareID(secret string, id string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// shareToken the token of a public link, its id and a signature of the id.
+// Only the id is saved, so ids from the database can't be made into links
+// without the secret, and made up tokens are turned away before looking
+// in the database
+func shareToken(secret string, id string) string {
+	return id + "." + signShareID(secret, id)
+}
+
+// shareID the id in a token, if the token was signed with the secret
+func shareID(secret string, token string) (string, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return "", false
+	}
+	want := signShareID(secret, parts[0])
+	return parts[0], hmac.Equal([]byte(parts[1]), []byte(want))
+}
+
+// liveShare the share and the idea behind a token. Writes a 404 (or a 410
+// for a link that was revoked or has expired) and returns false if there
+// isn't one to show
+func liveShare(env *models.Env, repo *repository.DataRepository, w http.ResponseWriter, r *http.Request) (*models.Share, *models.Idea, bool) {
+	id, ok := shareID(env.Cfg.Share.Secret, mux.Vars(r)["token"])
+	if !ok {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	share, err := repo.GetShare(id)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	if !share.Live(time.Now()) {
+		http.Error(w, "This link has expired", http.StatusGone)
+		return nil, nil, false
+	}
+
+	ideaID, err := uuid.Parse(share.Idea)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	idea, err := repo.GetIdea(share.Owner, ideaID)
+	if err != nil {
+		// the idea has been deleted from the library
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+	return share, idea, true
+}
+
+// ServeCreateShare makes a public link to one of the logged in user's saved
+// ideas, which can expire after a number of days
+func ServeCreateShare(env *models.Env, repo *repository.DataRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := models.UserFrom(r.Context())
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+			return
+		}
+
+		ideaID, err := uuid.Parse(mux.Vars(r)["id"])
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		idea, err := repo.GetIdea(user.UUID, ideaID)
+		if err != nil {
+			env.Log.Printf("Could not get idea %v: %v", ideaID, err)
+			http.NotFound(w, r)
+			return
+		}
+
+		var expires *time.Time
+		if frmExpires := strings.TrimSpace(r.FormValue("expires")); frmExpires != "" {
+			days, err := strconv.Atoi(frmExpires)
+			if err != nil || days < 1 || days > maxShareDays {
+				writeFieldErrors(w, []fieldError{{"expires", frmExpires, "must be a number of days from 1 to 365"}})
+				return
+			}
+			at := time.Now().UTC().AddDate(0, 0, days)
+			expires = &at
+		}
+
+		id, err := newShareID()
+		if err != nil {
+			env.Log.Printf("Could not make share id: %v", err)
+			http.Error(w, "Could not share idea", http.StatusInternalServerError)
+			return
+		}
+		if err := repo.CreateShare(models.NewShare(id, idea, expires)); err != nil {
+			env.Log.Printf("Could not share idea %v: %v", ideaID, err)
+			http.Error(w, "Could not share idea", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/-/library", http.StatusSeeOther)
+	}
+}
+
+// ServeRevokeShare stops one of the logged in user's public links working
+func ServeRevokeShare(env *models.Env, repo *repository.DataRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := models.UserFrom(r.Context())
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusTemporaryRedirect)
+			return
+		}
+
+		id, ok := shareID(env.Cfg.Share.Secret, mux.Vars(r)["token"])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if err := repo.RevokeShare(user.UUID, id); err != nil {
+			env.Log.Printf("Could not revoke share %v: %v", id, err)
+			http.NotFound(w, r)
+			return
+		}
+
+		http.Redirect(w, r, "/-/library", http.StatusSeeOther)
+	}
+}
+
+// ServeSharePage shows a shared idea to anyone with the link
+func ServeSharePage(env *models.Env, t *template.Template, repo *repository.DataRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		share, idea, ok := liveShare(env, repo, w, r)
+		if !ok {
+			return
+		}
+		req, err := savedRequest(idea)
+		if err != nil {
+			env.Log.Printf("Could not read idea %v: %v", idea.UUID, err)
+			http.Error(w, "Could not read idea", http.StatusInternalServerError)
+			return
+		}
+
+		pd := sharePage{
+			pageData: pageData{
+				"Songmatic: " + idea.Name,
+				"Songmatic Template",
+			},
+			Token:       mux.Vars(r)["token"],
+			Name:        idea.Name,
+			Part:        req.Part.String(),
+			Key:         req.Key,
+			Meter:       req.Idea.Meter.String(),
+			Tempo:       req.Idea.Tempo,
+			Bars:        req.Idea.Bars,
+			Progression: req.Idea.Progression.Numerals(req.Idea.Scale),
+			Chords:      req.Idea.Progression.Symbols(req.Idea.Scale),
+			Expires:     share.Expires,
+		}
+
+		w.WriteHeader(200)
+		t.ExecuteTemplate(w, "share.html", pd)
+	}
+}
+
+// ServeShareDownload sends the midi file of a shared idea to anyone with
+// the link
+func ServeShareDownload(env *models.Env, repo *repository.DataRepository) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		share, idea, ok := liveShare(env, repo, w, r)
+		if !ok {
+			return
+		}
+		req, err := savedRequest(idea)
+		if err != nil {
+			env.Log.Printf("Could not read idea %v: %v", idea.UUID, err)
+			http.Error(w, "Could not read idea", http.StatusInternalServerError)
+			return
+		}
+
+		if share.Blob != nil && *share.Blob != "" {
+			data, err := env.Blobs.Get(*share.Blob)
+			if err == nil {
+				writeMidi(w, req, data)
+				return
+			}
+			env.Log.Printf("Could not get blob %v for share: %v", *share.Blob, err)
+		}
+		writeMidi(w, req, req.Gen.Generate(req.Part, req.Idea))
+	}
+}
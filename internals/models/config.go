@@ -25,6 +25,16 @@ type Config struct {
 		AuthStyle      int      `conf:"default:1"`
 		AccessTokenURL string   `conf:"default:https://www.googleapis.com/oauth2/v2/userinfo?access_token="`
 	}
+	Share struct {
+		// signs the tokens of public links, links stop working if it changes.
+		// There is no default, as anyone who knows it can make links
+		Secret string `conf:"required,noprint"`
+	}
+	Blobs struct {
+		// "file" to keep midi files under Root, or "db" to keep them in the database
+		Store string `conf:"default:file"`
+		Root  string `conf:"default:datastore"`
+	}
 	DB struct {
 		Driver     string `conf:"default:postgres"`
 		Connection string `conf:"default:host=db port=5432 user=postgres dbname=postgres password=postgres sslmode=disable,noprint"`
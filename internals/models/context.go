@@ -0,0 +1,19 @@
+package models
+
+import "context"
+
+type contextKey string
+
+// userKey is where the logged in user is kept in a request's context
+const userKey contextKey = "user"
+
+// WithUser a context that carries the logged in user
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey, user)
+}
+
+// UserFrom the logged in user in a context, nil if nobody is logged in
+func UserFrom(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey).(*User)
+	return user
+}
@@ -5,11 +5,13 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/jmoiron/sqlx"
+	"github.com/robrohan/legendary-doodle/internals/blobstore"
 )
 
 // Env context for db, logger, etc. This is passed within a request
 type Env struct {
 	Db        *sqlx.DB
+	Blobs     blobstore.Store
 	Log       *log.Logger
 	Cfg       *Config
 	Router    *mux.Router
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 // UserInfo is the data we get back from the auth service
 type UserInfo struct {
@@ -30,3 +34,63 @@ func NewUser(authid string, email string, picture string) *User {
 	}
 	return &a
 }
+
+// Idea is a generated idea a user has saved (saved in the db). Spec is the
+// query string it was made from, with the seed in it, so making it again
+// gives the same notes. Blob is the hash of the midi file in the blob store
+type Idea struct {
+	UUID    string    `db:"uuid"`
+	Owner   string    `db:"owner"`
+	Name    string    `db:"name"`
+	Spec    string    `db:"spec"`
+	Seed    int64     `db:"seed"`
+	Blob    *string   `db:"blob"`
+	Created time.Time `db:"created"`
+}
+
+func NewIdea(owner string, name string, spec string, seed int64, blob string) *Idea {
+	id := uuid.New()
+	a := Idea{
+		UUID:    id.String(),
+		Owner:   owner,
+		Name:    name,
+		Spec:    spec,
+		Seed:    seed,
+		Blob:    &blob,
+		Created: time.Now().UTC(),
+	}
+	return &a
+}
+
+// Share is a public link to one of a user's saved ideas (saved in the db).
+// Token is the random part of the link, Blob the hash of the midi file it
+// plays. Expires is nil for a link that never expires
+type Share struct {
+	Token   string     `db:"token"`
+	Idea    string     `db:"idea"`
+	Owner   string     `db:"owner"`
+	Blob    *string    `db:"blob"`
+	Created time.Time  `db:"created"`
+	Expires *time.Time `db:"expires"`
+	Revoked *time.Time `db:"revoked"`
+}
+
+func NewShare(token string, idea *Idea, expires *time.Time) *Share {
+	a := Share{
+		Token:   token,
+		Idea:    idea.UUID,
+		Owner:   idea.Owner,
+		Blob:    idea.Blob,
+		Created: time.Now().UTC(),
+		Expires: expires,
+	}
+	return &a
+}
+
+// Live true if the link hasn't been revoked and hasn't expired
+func (s *Share) Live(now time.Time) bool {
+	if s.Revoked != nil {
+		return false
+	}
+	return s.Expires == nil || now.Before(*s.Expires)
+}
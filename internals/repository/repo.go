@@ -3,6 +3,7 @@ package repository
 import (
 	"errors"
 	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
@@ -14,6 +15,14 @@ type DataRepository struct {
 	upsertUserQuery     *sqlx.Stmt
 	getUserByEmailQuery *sqlx.Stmt
 	getUserByIdQuery    *sqlx.Stmt
+	saveIdeaQuery       *sqlx.Stmt
+	listIdeasQuery      *sqlx.Stmt
+	getIdeaQuery        *sqlx.Stmt
+	deleteIdeaQuery     *sqlx.Stmt
+	createShareQuery    *sqlx.Stmt
+	getShareQuery       *sqlx.Stmt
+	listSharesQuery     *sqlx.Stmt
+	revokeShareQuery    *sqlx.Stmt
 }
 
 func prepareQuery(query string, db *sqlx.DB) *sqlx.Stmt {
@@ -50,6 +59,53 @@ func Attach(schema string, db *sqlx.DB, driver string) *DataRepository {
 		WHERE uuid = $1
 	`, db)
 
+	a.saveIdeaQuery = prepareQuery(`
+		INSERT INTO ideas (uuid, owner, name, spec, seed, blob, created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, db)
+
+	a.listIdeasQuery = prepareQuery(`
+		SELECT uuid, owner, name, spec, seed, blob, created
+		FROM ideas
+		WHERE owner = $1
+		ORDER BY created DESC
+	`, db)
+
+	a.getIdeaQuery = prepareQuery(`
+		SELECT uuid, owner, name, spec, seed, blob, created
+		FROM ideas
+		WHERE uuid = $1 AND owner = $2
+	`, db)
+
+	a.deleteIdeaQuery = prepareQuery(`
+		DELETE FROM ideas
+		WHERE uuid = $1 AND owner = $2
+	`, db)
+
+	a.createShareQuery = prepareQuery(`
+		INSERT INTO shares (token, idea, owner, blob, created, expires)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, db)
+
+	a.getShareQuery = prepareQuery(`
+		SELECT token, idea, owner, blob, created, expires, revoked
+		FROM shares
+		WHERE token = $1
+	`, db)
+
+	a.listSharesQuery = prepareQuery(`
+		SELECT token, idea, owner, blob, created, expires, revoked
+		FROM shares
+		WHERE owner = $1 AND revoked IS NULL
+		ORDER BY created DESC
+	`, db)
+
+	a.revokeShareQuery = prepareQuery(`
+		UPDATE shares
+		SET revoked = $1
+		WHERE token = $2 AND owner = $3 AND revoked IS NULL
+	`, db)
+
 	return &a
 }
 
@@ -107,3 +163,117 @@ func (r *DataRepository) GetUser(email string) (*models.User, error) {
 
 	return &user, nil
 }
+
+// SaveIdea adds an idea to its owner's library
+func (r *DataRepository) SaveIdea(idea *models.Idea) error {
+	_, err := r.saveIdeaQuery.Exec(
+		idea.UUID, idea.Owner, idea.Name, idea.Spec, idea.Seed, idea.Blob, idea.Created,
+	)
+	return err
+}
+
+// ListIdeas all the ideas a user has saved, newest first
+func (r *DataRepository) ListIdeas(owner string) ([]models.Idea, error) {
+	ideas := []models.Idea{}
+	rows, err := r.listIdeasQuery.Queryx(owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		idea := models.Idea{}
+		err = rows.StructScan(&idea)
+		if err != nil {
+			return nil, err
+		}
+		ideas = append(ideas, idea)
+	}
+
+	return ideas, rows.Err()
+}
+
+// GetIdea one of a user's ideas. Ideas saved by someone else are not found
+func (r *DataRepository) GetIdea(owner string, id uuid.UUID) (*models.Idea, error) {
+	idea := models.Idea{}
+	err := r.getIdeaQuery.QueryRowx(id.String(), owner).StructScan(&idea)
+	if err != nil {
+		return nil, err
+	}
+
+	return &idea, nil
+}
+
+// DeleteIdea removes one of a user's ideas from their library
+func (r *DataRepository) DeleteIdea(owner string, id uuid.UUID) error {
+	res, err := r.deleteIdeaQuery.Exec(id.String(), owner)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("no rows")
+	}
+
+	return nil
+}
+
+// CreateShare adds a public link to an idea
+func (r *DataRepository) CreateShare(share *models.Share) error {
+	_, err := r.createShareQuery.Exec(
+		share.Token, share.Idea, share.Owner, share.Blob, share.Created, share.Expires,
+	)
+	return err
+}
+
+// GetShare a public link by its token, revoked or expired or not
+func (r *DataRepository) GetShare(token string) (*models.Share, error) {
+	share := models.Share{}
+	err := r.getShareQuery.QueryRowx(token).StructScan(&share)
+	if err != nil {
+		return nil, err
+	}
+
+	return &share, nil
+}
+
+// ListShares the public links a user hasn't revoked, newest first
+func (r *DataRepository) ListShares(owner string) ([]models.Share, error) {
+	shares := []models.Share{}
+	rows, err := r.listSharesQuery.Queryx(owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		share := models.Share{}
+		err = rows.StructScan(&share)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// RevokeShare stops one of a user's public links from working
+func (r *DataRepository) RevokeShare(owner string, token string) error {
+	res, err := r.revokeShareQuery.Exec(time.Now().UTC(), token, owner)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("no rows")
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package songmatic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2/gm"
+)
+
+// ArpDirection the order an arpeggio plays the notes of a chord in
+type ArpDirection int
+
+const (
+	ArpUp      ArpDirection = 0
+	ArpDown    ArpDirection = 1
+	ArpUpDown  ArpDirection = 2
+	ArpRandom  ArpDirection = 3
+	ArpPattern ArpDirection = 4
+)
+
+var arpDirectionNames = [5]string{"up", "down", "updown", "random", "pattern"}
+
+func (a ArpDirection) String() string {
+	if a < ArpUp || a > ArpPattern {
+		return fmt.Sprintf("arp%d", int(a))
+	}
+	return arpDirectionNames[a]
+}
+
+// ParseArpDirection turns a direction name ("updown") or number ("2") into
+// an ArpDirection
+func ParseArpDirection(name string) (ArpDirection, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range arpDirectionNames {
+		if name == n || name == fmt.Sprintf("%d", i) {
+			return ArpDirection(i), nil
+		}
+	}
+	return ArpUp, fmt.Errorf("unknown arpeggio direction: %v", name)
+}
+
+// ArpRate how fast an arpeggio plays
+type ArpRate int
+
+const (
+	Arp8th     ArpRate = 0
+	Arp16th    ArpRate = 1
+	ArpTriplet ArpRate = 2
+)
+
+var arpRateNames = [3]string{"8", "16", "triplet"}
+
+func (a ArpRate) String() string {
+	if a < Arp8th || a > ArpTriplet {
+		return fmt.Sprintf("rate%d", int(a))
+	}
+	return arpRateNames[a]
+}
+
+// ParseArpRate reads a rate of "8", "16" or "triplet" (8th note triplets)
+func ParseArpRate(name string) (ArpRate, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range arpRateNames {
+		if name == n {
+			return ArpRate(i), nil
+		}
+	}
+	return Arp16th, fmt.Errorf("unknown arpeggio rate: %v", name)
+}
+
+// Ticks how long each note of the arpeggio lasts
+func (a ArpRate) Ticks() uint32 {
+	switch a {
+	case Arp8th:
+		return clock.Ticks8th()
+	case ArpTriplet:
+		return clock.Ticks4th() / 3
+	}
+	return clock.Ticks16th()
+}
+
+// Arpeggio how a chord progression is played one note at a time
+type Arpeggio struct {
+	Direction ArpDirection
+	Rate      ArpRate
+	// how many octaves the chord is spread over going up
+	Octaves int
+	// the notes to play for ArpPattern, as 0 based indexes into the chord
+	// going up. Indexes past the top of the chord wrap around
+	Pattern []int
+}
+
+// ParseArpPattern reads a pattern of 1 based chord notes separated by
+// spaces, dashes or commas, for example "1 3 2 4"
+func ParseArpPattern(text string) ([]int, error) {
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == '-' || r == ',' || r == ' '
+	})
+
+	var pattern []int
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("unknown arpeggio pattern: %v", text)
+		}
+		pattern = append(pattern, n-1)
+	}
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("no notes in arpeggio pattern: %v", text)
+	}
+	return pattern, nil
+}
+
+// arpNotes the keys of a chord spread over octaves going up
+func arpNotes(chord []uint8, octaves int) []uint8 {
+	if octaves < 1 {
+		octaves = 1
+	}
+	var notes []uint8
+	for o := 0; o < octaves; o++ {
+		for _, k := range chord {
+			notes = append(notes, midiKey(int(k)+12*o))
+		}
+	}
+	return notes
+}
+
+// arpNext the note to play at position n of the arpeggio
+func (g *Generator) arpNext(arp Arpeggio, notes []uint8, n int) uint8 {
+	size := len(notes)
+	switch arp.Direction {
+	case ArpDown:
+		return notes[size-1-n%size]
+	case ArpUpDown:
+		if size < 2 {
+			return notes[0]
+		}
+		// up and back down without playing the top and bottom twice
+		cycle := 2*size - 2
+		pos := n % cycle
+		if pos >= size {
+			pos = cycle - pos
+		}
+		return notes[pos]
+	case ArpRandom:
+		return notes[g.rand.Intn(size)]
+	case ArpPattern:
+		if len(arp.Pattern) > 0 {
+			return notes[arp.Pattern[n%len(arp.Pattern)]%size]
+		}
+	}
+	return notes[n%size]
+}
+
+// arpBarEvents one bar of an arpeggio over the progression. The arpeggio
+// starts again every time the chord changes. Triplets do not fall on the
+// 16th note grid, so they are put on the step before and pushed late with
+// the event's Offset
+func (g *Generator) arpBarEvents(idea Idea, v *voicer, bar int) BarEvents {
+	arp := idea.Arp
+	prog := idea.Progression
+	steps := idea.Meter.Steps()
+	step16 := clock.Ticks16th()
+	rate := arp.Rate.Ticks()
+	total := uint32(steps) * step16
+
+	var tune = make([]BarEvent, steps)
+	for i := range tune {
+		tune[i] = BarEvent{[]uint8{0}, step16, 0, 0}
+	}
+
+	var notes []uint8
+	n, last := 0, -1
+	for tick := uint32(0); tick < total; tick += rate {
+		step := int(tick / step16)
+		if last < 0 || prog.ChangesBetween(last, step, steps) {
+			notes = arpNotes(v.voice(idea.Scale, prog.At(bar, step, steps)), arp.Octaves)
+			n = 0
+		}
+		last = step
+
+		velocity := g.RandMidiRange(70, 95)
+		if n == 0 {
+			velocity = g.RandMidiRange(90, 110)
+		}
+		tune[step] = BarEvent{
+			[]uint8{g.arpNext(arp, notes, n)},
+			rate,
+			velocity,
+			int32(tick - uint32(step)*step16),
+		}
+		n++
+	}
+	return tune
+}
+
+func (g *Generator) RandomArp(idea Idea) []byte {
+	return mkSMF(idea, g.humanize(idea, g.arpSnippet(idea)))
+}
+
+func (g *Generator) arpSnippet(idea Idea) SongSnippet {
+	var snippet SongSnippet
+	snippet.Tracks = make([]BarTracks, idea.Bars)
+
+	// arpeggios sound best from close voicings
+	v := &voicer{style: VoicingPiano, jazz: idea.Jazz}
+	for m := 0; m < idea.Bars; m++ {
+		snippet.Tracks[m] = BarTracks{g.arpBarEvents(idea, v, m)}
+	}
+
+	snippet.Part = PartArp
+	snippet.Channel = 3
+	snippet.Instr = gm.Instr_Lead2Sawtooth
+	return snippet
+}
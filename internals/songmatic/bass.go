@@ -0,0 +1,150 @@
+package songmatic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BassStyle how a bass line moves over the chords
+type BassStyle int
+
+const (
+	// Roots on the downbeats and chord changes, other chord tones in between
+	BassRoot BassStyle = 0
+	// Root on the strong beats, fifth on the weak beats
+	BassRootFifth BassStyle = 1
+	// Quarter notes walking through the chord with a chromatic approach
+	// into the next chord
+	BassWalking BassStyle = 2
+	// 8th notes jumping between the root and the octave above
+	BassOctave BassStyle = 3
+)
+
+var bassStyleNames = [4]string{"root", "rootfifth", "walking", "octave"}
+
+func (b BassStyle) String() string {
+	if b < BassRoot || b > BassOctave {
+		return fmt.Sprintf("bass%d", int(b))
+	}
+	return bassStyleNames[b]
+}
+
+// ParseBassStyle turns a style name ("walking") or number ("2") into a
+// BassStyle
+func ParseBassStyle(name string) (BassStyle, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range bassStyleNames {
+		if name == n || name == fmt.Sprintf("%d", i) {
+			return BassStyle(i), nil
+		}
+	}
+	return BassRoot, fmt.Errorf("unknown bass style: %v", name)
+}
+
+// bass notes sit two octaves below the chords
+const bassOctave = -2
+
+// Generate one bar of bass that follows the chords in the progression
+func (g *Generator) bassBarEvents(idea Idea, bar int) BarEvents {
+	scale := idea.Scale
+	lines := melodyScale(idea)
+	meter := idea.Meter
+	prog := idea.Progression
+	steps := meter.Steps()
+	pulses := meter.Pulses()
+
+	var tune = make([]BarEvent, steps)
+	for i := range tune {
+		tune[i] = BarEvent{[]uint8{0}, clock.Ticks16th(), 0, 0}
+	}
+
+	switch idea.Bass {
+	case BassRootFifth:
+		for p, i := range pulses {
+			chord := prog.At(bar, i, steps)
+			tone := 0
+			if p%2 == 1 && !prog.ChangesBetween(pulses[p-1], i, steps) {
+				tone = 2
+			}
+			tune[i] = g.bassNote(scale.ChordTone(chord, tone, bassOctave), p == 0)
+		}
+
+	case BassWalking:
+		for p, i := range pulses {
+			chord := prog.At(bar, i, steps)
+			nextBar, nextStep := bar, steps
+			if p+1 < len(pulses) {
+				nextStep = pulses[p+1]
+			}
+			if nextStep >= steps {
+				nextBar, nextStep = bar+1, 0
+			}
+
+			var key uint8
+			if p == 0 || prog.ChangesBetween(pulses[p-1], i, steps) {
+				key = scale.Root(chord, bassOctave)
+			} else if nextStep == 0 || prog.ChangesBetween(i, nextStep, steps) {
+				// chromatic approach from a half step above or below
+				next := scale.Root(prog.At(nextBar, nextStep, steps), bassOctave)
+				if g.rand.Intn(2) == 0 {
+					key = next - 1
+				} else {
+					key = next + 1
+				}
+			} else {
+				// passing notes come from the scale of the lines, which
+				// may not be the scale of the key
+				root := lines.Nearest(scale.Root(chord, 0))
+				passing := []int8{1, 2, 2, 4, 4, 5}
+				key = lines.Key(root+int(g.RandomFromSlice(passing)), bassOctave)
+			}
+			tune[i] = g.bassNote(key, p == 0)
+		}
+
+	case BassOctave:
+		for i := 0; i < steps; i += 2 {
+			chord := prog.At(bar, i, steps)
+			octave := int8(bassOctave)
+			if (i/2)%2 == 1 {
+				octave++
+			}
+			tune[i] = g.bassNote(scale.Root(chord, octave), i == 0)
+		}
+
+	default:
+		// 1 e + a 2 e + a 3 e + a 4 e + a
+		// 0 1 2 3 4 5 6 7 8 9 A B C D E F
+		t := idea.Swing.Grid(g.GenerateRhythm(meter.BiasOne()))
+		for i := 0; i < steps; i++ {
+			chord := prog.At(bar, i, steps)
+			if prog.ChangesAt(i, steps) {
+				tune[i] = g.bassNote(scale.Root(chord, bassOctave), i == 0)
+			} else if t[i] {
+				// mostly the root, then the fifth and the third
+				tones := []int8{0, 0, 0, 1, 2, 2}
+				tone := int(g.RandomFromSlice(tones))
+				tune[i] = g.bassNote(scale.ChordTone(chord, tone, bassOctave), false)
+			}
+		}
+	}
+
+	// walking lines join up, octaves bounce and the rest leave a little
+	// space between notes
+	switch idea.Bass {
+	case BassWalking:
+		articulate(tune, Legato)
+	case BassOctave:
+		articulate(tune, Staccato)
+	default:
+		articulate(tune, Detached)
+	}
+	return tune
+}
+
+// bassNote a single bass note, a bit louder on the downbeat
+func (g *Generator) bassNote(key uint8, downbeat bool) BarEvent {
+	if downbeat {
+		return BarEvent{[]uint8{key}, clock.Ticks16th(), g.RandMidiRange(95, 115), 0}
+	}
+	return BarEvent{[]uint8{key}, clock.Ticks16th(), g.RandMidiRange(75, 100), 0}
+}
@@ -0,0 +1,104 @@
+package songmatic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Complexity how far chords are taken past plain triads
+type Complexity int
+
+const (
+	// Chords are played as they are written
+	ComplexityTriads Complexity = 0
+	// Every chord gets its seventh
+	ComplexitySevenths Complexity = 1
+	// Sevenths with a 9 on top where it fits
+	ComplexityNinths Complexity = 2
+	// 9ths, 11ths on minor chords and 13ths on major and dominant chords
+	ComplexityExtended Complexity = 3
+	// Extended chords with altered tensions on the dominants, which are
+	// sometimes swapped for their tritone substitute
+	ComplexityAltered Complexity = 4
+)
+
+var complexityNames = [5]string{"triads", "sevenths", "ninths", "extended", "altered"}
+
+func (c Complexity) String() string {
+	if c < ComplexityTriads || c > ComplexityAltered {
+		return fmt.Sprintf("complexity%d", int(c))
+	}
+	return complexityNames[c]
+}
+
+// ParseComplexity turns a level name ("extended") or number ("3") into a
+// Complexity
+func ParseComplexity(name string) (Complexity, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range complexityNames {
+		if name == n || name == fmt.Sprintf("%d", i) {
+			return Complexity(i), nil
+		}
+	}
+	return ComplexityTriads, fmt.Errorf("unknown complexity: %v", name)
+}
+
+// Complicate adds sevenths, tensions, altered tensions and tritone
+// substitutions to the chords of a progression, up to a level of
+// complexity. Tensions that clash with a chord are left out when it is
+// played, so they can be added to every chord here
+func (g *Generator) Complicate(scale Scale, prog Progression, level Complexity) Progression {
+	if level <= ComplexityTriads {
+		return prog
+	}
+
+	_, triads, sevenths := ScaleDegrees(scale.Mode)
+
+	out := Progression{PerBar: prog.PerBar}
+	for _, c := range prog.Chords {
+		c.Seventh = true
+		c.Tensions = append([]int{}, c.Tensions...)
+		c.Altered = append([]int{}, c.Altered...)
+		dominant := sevenths[c.Degree] == "7"
+
+		switch level {
+		case ComplexitySevenths:
+		case ComplexityNinths:
+			c.Tensions = addTension(c.Tensions, 9)
+		default:
+			c.Tensions = addTension(c.Tensions, 9)
+			switch triads[c.Degree] {
+			case "m":
+				c.Tensions = addTension(c.Tensions, 11)
+			case "M":
+				c.Tensions = addTension(c.Tensions, 13)
+			}
+		}
+
+		if level >= ComplexityAltered && dominant {
+			// at least one altered tension, and maybe a couple more
+			for i, a := range g.rand.Perm(len(alterations)) {
+				if i == 0 || g.rand.Intn(3) == 0 {
+					c.Altered = append(c.Altered, alterations[a].semitones)
+				}
+			}
+			sort.Ints(c.Altered)
+			if g.rand.Intn(2) == 0 {
+				c.TritoneSub = true
+			}
+		}
+
+		out.Chords = append(out.Chords, c)
+	}
+	return out
+}
+
+func addTension(tensions []int, t int) []int {
+	for _, have := range tensions {
+		if have == t {
+			return tensions
+		}
+	}
+	return append(tensions, t)
+}
@@ -0,0 +1,291 @@
+package songmatic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2/gm"
+)
+
+// DrumVoice one drum in a style, and how likely it is to be hit on each 16th
+// note step of a bar
+type DrumVoice struct {
+	Key      gm.DrumKey
+	Chance   []float64
+	Velocity [2]int
+	// chance a hit is played as a 32nd note roll
+	Roll float64
+}
+
+// DrumStyle a genre of beat made from a set of drum voices
+type DrumStyle struct {
+	Name   string
+	Voices []DrumVoice
+}
+
+// The styles are written out in 4/4, and fitted to other meters with In
+//
+//	1   e   +   a   2   e   +   a   3   e   +   a   4   e   +   a
+var drumStyles = map[string]DrumStyle{
+	"rock": {"rock", []DrumVoice{
+		{gm.DrumKey_AcousticBassDrum, []float64{1, 0, 0, 0, 0, 0, 0, .2, .9, 0, .4, 0, 0, 0, .2, 0}, [2]int{90, 115}, 0},
+		{gm.DrumKey_AcousticSnare, []float64{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, .1}, [2]int{95, 120}, 0},
+		{gm.DrumKey_ClosedHiHat, []float64{1, 0, .9, 0, 1, 0, .9, 0, 1, 0, .9, 0, 1, 0, .6, 0}, [2]int{60, 90}, 0},
+		{gm.DrumKey_OpenHiHat, []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, .3, 0}, [2]int{60, 85}, 0},
+	}},
+	"house": {"house", []DrumVoice{
+		{gm.DrumKey_BassDrum1, []float64{1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0}, [2]int{100, 120}, 0},
+		{gm.DrumKey_HandClap, []float64{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0}, [2]int{85, 105}, 0},
+		{gm.DrumKey_ClosedHiHat, []float64{.3, .5, 0, .5, .3, .5, 0, .5, .3, .5, 0, .5, .3, .5, 0, .5}, [2]int{50, 75}, 0},
+		{gm.DrumKey_OpenHiHat, []float64{0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 1, 0}, [2]int{70, 90}, 0},
+	}},
+	"boombap": {"boombap", []DrumVoice{
+		{gm.DrumKey_AcousticBassDrum, []float64{1, 0, 0, 0, 0, 0, 0, .3, .2, 0, .8, 0, 0, 0, 0, .2}, [2]int{95, 120}, 0},
+		{gm.DrumKey_AcousticSnare, []float64{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0}, [2]int{100, 120}, 0},
+		{gm.DrumKey_ClosedHiHat, []float64{.9, 0, .9, 0, .9, 0, .9, 0, .9, 0, .9, 0, .9, 0, .9, .2}, [2]int{55, 85}, 0},
+	}},
+	"breakbeat": {"breakbeat", []DrumVoice{
+		{gm.DrumKey_AcousticBassDrum, []float64{1, 0, 1, 0, 0, 0, 0, 0, 0, 0, .8, .5, 0, 0, 0, 0}, [2]int{95, 120}, 0},
+		{gm.DrumKey_AcousticSnare, []float64{0, 0, 0, 0, 1, 0, 0, .6, 0, .6, 0, 0, 1, 0, 0, .4}, [2]int{90, 120}, 0},
+		{gm.DrumKey_RideCymbal1, []float64{1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0}, [2]int{60, 85}, 0},
+	}},
+	"bossanova": {"bossanova", []DrumVoice{
+		{gm.DrumKey_AcousticBassDrum, []float64{1, 0, 0, .8, 1, 0, 0, .8, 1, 0, 0, .8, 1, 0, 0, .8}, [2]int{70, 90}, 0},
+		{gm.DrumKey_SideStick, []float64{.9, 0, 0, .9, 0, 0, .9, 0, 0, 0, .9, 0, 0, .9, 0, 0}, [2]int{70, 95}, 0},
+		{gm.DrumKey_ClosedHiHat, []float64{.9, .7, .9, .7, .9, .7, .9, .7, .9, .7, .9, .7, .9, .7, .9, .7}, [2]int{40, 70}, 0},
+	}},
+	"trap": {"trap", []DrumVoice{
+		{gm.DrumKey_BassDrum1, []float64{1, 0, 0, 0, 0, 0, 0, .5, 0, 0, .7, 0, 0, .3, 0, 0}, [2]int{100, 127}, 0},
+		{gm.DrumKey_HandClap, []float64{0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0}, [2]int{100, 120}, 0},
+		{gm.DrumKey_ClosedHiHat, []float64{1, .8, 1, .8, 1, .8, 1, .8, 1, .8, 1, .8, 1, .8, 1, .8}, [2]int{55, 90}, .2},
+		{gm.DrumKey_OpenHiHat, []float64{0, 0, 0, 0, 0, 0, .2, 0, 0, 0, 0, 0, 0, 0, .3, 0}, [2]int{60, 80}, 0},
+	}},
+	"jazz": {"jazz", []DrumVoice{
+		{gm.DrumKey_RideCymbal1, []float64{1, 0, 0, 0, 1, 0, 0, .9, 1, 0, 0, 0, 1, 0, 0, .9}, [2]int{65, 90}, 0},
+		{gm.DrumKey_PedalHiHat, []float64{0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0}, [2]int{55, 75}, 0},
+		{gm.DrumKey_AcousticBassDrum, []float64{.3, 0, 0, 0, .3, 0, 0, 0, .3, 0, 0, 0, .3, 0, 0, 0}, [2]int{35, 55}, 0},
+		{gm.DrumKey_AcousticSnare, []float64{0, 0, .1, .15, 0, 0, .1, .15, 0, 0, .1, .15, 0, 0, .1, .15}, [2]int{30, 60}, 0},
+	}},
+}
+
+// ParseDrumStyle finds a drum style by name. "basic" (or nothing) gives
+// the kick, snare and hat beat that follows the meter
+func ParseDrumStyle(name string) (DrumStyle, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == "basic" {
+		return DrumStyle{Name: "basic"}, nil
+	}
+	style, ok := drumStyles[name]
+	if !ok {
+		return DrumStyle{Name: "basic"}, fmt.Errorf("unknown drum style: %v", name)
+	}
+	return style, nil
+}
+
+// DrumStyleNames the names of all the drum styles
+func DrumStyleNames() []string {
+	names := []string{"basic"}
+	for name := range drumStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// In the style fitted to a meter. The chance of each step of the bar is the
+// average chance of the steps in 4/4 that are as strong, so the kick and
+// snare stay on the accents of the meter and the hats keep their feel. The
+// pulses that are neither a kick or a back beat (beat 2 of 5/4) get the
+// average of both
+func (s DrumStyle) In(meter Meter) DrumStyle {
+	if meter == Meter44 {
+		return s
+	}
+
+	fitted := DrumStyle{s.Name, make([]DrumVoice, len(s.Voices))}
+	for v, voice := range s.Voices {
+		var sum, count [5]float64
+		for i, chance := range voice.Chance {
+			level := Meter44.stepLevel(i)
+			sum[level] += chance
+			count[level]++
+		}
+		sum[2], count[2] = sum[0]+sum[1], count[0]+count[1]
+
+		voice.Chance = make([]float64, meter.Steps())
+		for i := range voice.Chance {
+			level := meter.stepLevel(i)
+			if count[level] > 0 {
+				voice.Chance[i] = sum[level] / count[level]
+			}
+		}
+		fitted.Voices[v] = voice
+	}
+	return fitted
+}
+
+// basicStyle a kick, snare and hat beat built from the biases of the meter
+// so it fits any time signature
+func basicStyle(meter Meter) DrumStyle {
+	chance := func(bias Rhythm) []float64 {
+		c := make([]float64, len(bias))
+		for i, on := range bias {
+			c[i] = .5
+			if on {
+				c[i] = 1
+			}
+		}
+		return c
+	}
+	return DrumStyle{"basic", []DrumVoice{
+		{gm.DrumKey_AcousticBassDrum, chance(meter.BiasKick()), [2]int{70, 110}, 0},
+		{gm.DrumKey_AcousticSnare, chance(meter.BiasSnare()), [2]int{30, 100}, 0},
+		{gm.DrumKey_ClosedHiHat, chance(meter.BiasCount()), [2]int{30, 100}, 0},
+	}}
+}
+
+// how likely a step of the groove is rolled again from one bar to the next
+const grooveVariation = 0.1
+
+// toms from high to low, for fills that walk down the kit
+var fillToms = []gm.DrumKey{
+	gm.DrumKey_HighTom,
+	gm.DrumKey_HiMidTom,
+	gm.DrumKey_LowMidTom,
+	gm.DrumKey_LowTom,
+	gm.DrumKey_HighFloorTom,
+	gm.DrumKey_LowFloorTom,
+}
+
+// phraseLength how many bars there are in a phrase, 4 if not given
+func phraseLength(idea Idea) int {
+	if idea.Phrase < 1 {
+		return 4
+	}
+	return idea.Phrase
+}
+
+// drumGroove rolls the hits of every voice in a style once, so all the bars
+// in a phrase can share the same core groove
+func (g *Generator) drumGroove(idea Idea, style DrumStyle) []Rhythm {
+	steps := idea.Meter.Steps()
+
+	groove := make([]Rhythm, len(style.Voices))
+	for v, voice := range style.Voices {
+		hits := make(Rhythm, steps)
+		for i := range hits {
+			hits[i] = g.rand.Float64() < voice.Chance[i]
+		}
+		groove[v] = idea.Swing.Grid(hits)
+	}
+	return groove
+}
+
+// Generate one bar of drums in a style from the groove of its phrase. The
+// first bar of a phrase plays the groove as is, and starts with a crash.
+// The other bars change a few of the hits that are not always played, and
+// the last bar ends with a fill. Every voice gets its own track, and voices
+// that roll get a second track with the extra hits pushed a 32nd late
+func (g *Generator) drumBarTracks(idea Idea, style DrumStyle, groove []Rhythm, bar int) BarTracks {
+	steps := idea.Meter.Steps()
+	phrase := phraseLength(idea)
+	first := bar%phrase == 0
+	last := bar%phrase == phrase-1 || bar == idea.Bars-1
+
+	// fill the last beat of the phrase, and sometimes the last two
+	fillStart := steps
+	if last {
+		pulses := idea.Meter.Pulses()
+		fillStart = pulses[len(pulses)-1]
+		if len(pulses) > 1 && g.rand.Intn(4) == 0 {
+			fillStart = pulses[len(pulses)-2]
+		}
+	}
+
+	var tracks BarTracks
+	for v, voice := range style.Voices {
+		hits := make(Rhythm, steps)
+		copy(hits, groove[v])
+		if !first {
+			for i := range hits {
+				chance := voice.Chance[i]
+				if chance < 1 && g.rand.Float64() < grooveVariation {
+					hits[i] = g.rand.Float64() < chance
+				}
+			}
+			hits = idea.Swing.Grid(hits)
+		}
+
+		var notes = make([]BarEvent, steps)
+		var rolls = make([]BarEvent, steps)
+		rolled := false
+		for i := 0; i < fillStart; i++ {
+			if !hits[i] {
+				continue
+			}
+			velocity := g.RandMidiRange(voice.Velocity[0], voice.Velocity[1])
+			notes[i] = BarEvent{[]uint8{voice.Key.Key()}, clock.Ticks16th(), velocity, 0}
+			if voice.Roll > 0 && g.rand.Float64() < voice.Roll {
+				rolls[i] = BarEvent{[]uint8{voice.Key.Key()}, clock.Ticks32th(), velocity - velocity/4, int32(clock.Ticks32th())}
+				rolled = true
+			}
+		}
+
+		tracks = append(tracks, notes)
+		if rolled {
+			tracks = append(tracks, rolls)
+		}
+	}
+
+	if fillStart < steps {
+		tracks = append(tracks, g.drumFill(idea, fillStart))
+	}
+
+	// crash on the downbeat that starts each phrase
+	if first {
+		var crash = make([]BarEvent, steps)
+		crash[0] = BarEvent{[]uint8{gm.DrumKey_CrashCymbal1.Key()}, clock.Ticks16th(), g.RandMidiRange(95, 115), 0}
+		tracks = append(tracks, crash)
+	}
+
+	return tracks
+}
+
+// drumFill a fill from the step start to the end of the bar that gets
+// louder as it goes. It is either snare 16ths, toms walking down the kit,
+// or 8ths moving between the snare and the toms
+func (g *Generator) drumFill(idea Idea, start int) BarEvents {
+	steps := idea.Meter.Steps()
+	length := steps - start
+	kind := g.rand.Intn(3)
+
+	var fill = make([]BarEvent, steps)
+	for i := start; i < steps; i++ {
+		n := i - start
+		if idea.Swing.Shuffle && i%2 == 1 {
+			continue
+		}
+
+		var key gm.DrumKey
+		switch kind {
+		case 0:
+			key = gm.DrumKey_AcousticSnare
+		case 1:
+			key = fillToms[n*len(fillToms)/length]
+		default:
+			if n%2 == 1 {
+				continue
+			}
+			if (n/2)%2 == 0 {
+				key = gm.DrumKey_AcousticSnare
+			} else {
+				key = fillToms[n*len(fillToms)/length]
+			}
+		}
+
+		velocity := 70 + 50*n/length
+		fill[i] = BarEvent{[]uint8{key.Key()}, clock.Ticks16th(), g.RandMidiRange(velocity, velocity+8), 0}
+	}
+	return fill
+}
@@ -0,0 +1,107 @@
+package songmatic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Note lengths in ticks
+var (
+	Whole     = 4 * clock.Ticks4th()
+	Half      = 2 * clock.Ticks4th()
+	Quarter   = clock.Ticks4th()
+	Eighth    = clock.Ticks8th()
+	Sixteenth = clock.Ticks16th()
+)
+
+// Dotted a note length and a half
+func Dotted(length uint32) uint32 {
+	return length + length/2
+}
+
+// Tied one note held for all the lengths added together, which can run
+// over the end of the bar into the next one
+func Tied(lengths ...uint32) uint32 {
+	var total uint32
+	for _, l := range lengths {
+		total += l
+	}
+	return total
+}
+
+// Articulation how much of the time until the next note a note is held for
+type Articulation int
+
+const (
+	// Held for most of the time, with a small gap before the next note
+	Detached Articulation = 0
+	// Held for half the time
+	Staccato Articulation = 1
+	// Held a little into the next note so there is no gap at all
+	Legato Articulation = 2
+	// Held for all of the time
+	Tenuto Articulation = 3
+)
+
+var articulationNames = [4]string{"detached", "staccato", "legato", "tenuto"}
+
+func (a Articulation) String() string {
+	if a < Detached || a > Tenuto {
+		return fmt.Sprintf("articulation%d", int(a))
+	}
+	return articulationNames[a]
+}
+
+// ParseArticulation turns an articulation name ("legato") or number ("2")
+// into an Articulation
+func ParseArticulation(name string) (Articulation, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range articulationNames {
+		if name == n || name == fmt.Sprintf("%d", i) {
+			return Articulation(i), nil
+		}
+	}
+	return Detached, fmt.Errorf("unknown articulation: %v", name)
+}
+
+// Hold how long a note is held for when it is length ticks until the next
+// one
+func (a Articulation) Hold(length uint32) uint32 {
+	switch a {
+	case Staccato:
+		return length / 2
+	case Legato:
+		return length + clock.Ticks32th()/2
+	case Tenuto:
+		return length
+	}
+	if length <= Sixteenth {
+		return length - length/8
+	}
+	return length - Sixteenth/4
+}
+
+// articulate sets how long every note in a bar is held from the time until
+// the note after it, or until the end of the bar for the last one
+func articulate(tune BarEvents, a Articulation) {
+	next := len(tune)
+	for i := len(tune) - 1; i >= 0; i-- {
+		if tune[i].Keys == nil || tune[i].Velocity == 0 {
+			continue
+		}
+		tune[i].Length = a.Hold(uint32(next-i) * Sixteenth)
+		next = i
+	}
+}
+
+// holdLast holds the last note of a bar right up to the end of it, however
+// it was articulated, so a line can finish on a long note
+func holdLast(tune BarEvents) {
+	for i := len(tune) - 1; i >= 0; i-- {
+		if tune[i].Keys == nil || tune[i].Velocity == 0 {
+			continue
+		}
+		tune[i].Length = uint32(len(tune)-i) * Sixteenth
+		return
+	}
+}
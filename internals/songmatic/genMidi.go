@@ -2,14 +2,12 @@ package songmatic
 
 import (
 	"fmt"
-	"math"
 	"math/rand"
 	"strings"
 	"time"
 
 	"bytes"
 
-	"github.com/aquilax/go-perlin"
 	"gitlab.com/gomidi/midi/v2"
 	"gitlab.com/gomidi/midi/v2/gm"
 	"gitlab.com/gomidi/midi/v2/smf"
@@ -27,12 +25,45 @@ const (
 	Locrian    Mode = 6
 )
 
-var key [13]string
+var modeNames = [7]string{"ionian", "dorian", "phrygian", "lydian", "mixolydian", "aeolian", "locrian"}
 
-var degree [7]string
+func (m Mode) String() string {
+	if m < Ionian || m > Locrian {
+		return fmt.Sprintf("mode%d", int(m))
+	}
+	return modeNames[m]
+}
+
+// IsMajor true if the mode has a major third above its tonic. This is what
+// is used for the major / minor flag of the key signature
+func (m Mode) IsMajor() bool {
+	return m == Ionian || m == Lydian || m == Mixolydian
+}
 
-var interval [7]string
-var seventh [7]string
+// ParseMode turns a mode name ("dorian") or number ("1") into a Mode
+func ParseMode(name string) (Mode, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range modeNames {
+		if name == n || name == fmt.Sprintf("%d", i) {
+			return Mode(i), nil
+		}
+	}
+	switch name {
+	case "major":
+		return Ionian, nil
+	case "minor":
+		return Aeolian, nil
+	}
+	return Ionian, fmt.Errorf("unknown mode: %v", name)
+}
+
+var degree = [7]string{"I", "II", "III", "IV", "V", "VI", "VII°"}
+
+var interval = [7]string{"M", "m", "m", "M", "M", "m", "°"}
+
+// the diminished triad of the scale takes a minor seventh, which makes it
+// half diminished
+var seventh = [7]string{"∆7", "-7", "-7", "∆7", "7", "-7", "ø7"}
 
 // Sequence : MmmMMmdMmmMMmdMmmMMmd
 // I Major  : MmmMMmd                Ionian       0
@@ -43,16 +74,17 @@ var seventh [7]string
 // VI Minor :      mdMmmMM           Aeolian      5
 // VII      :       dMmmMMm          Locrian      6
 
-var notes [7]string
-
-var sharps [7]string
+var notes = [7]string{"A", "B", "C", "D", "E", "F", "G"}
 
-var midiMap map[string]uint8
+var sharps = [7]string{"F", "C", "G", "D", "A", "E", "B"}
 
+// Scale the notes of a scale going up from its tonic. Scales made from a key
+// signature have seven notes, scales made from a formula can have any number
 type Scale struct {
-	Notes       [7]string
+	Notes       []Pitch
 	Accidentals uint8
 	UseFlats    bool
+	Mode        Mode
 }
 
 // BarEvent A single event that happens within a bar on a beat. For example a chord
@@ -61,6 +93,8 @@ type BarEvent struct {
 	Keys     []uint8
 	Length   uint32
 	Velocity uint8
+	// Ticks the event is pushed late (or early if negative) off the grid
+	Offset int32
 }
 
 // BarEvents Several bar events (several notes). This would hold one whole bar of
@@ -78,83 +112,109 @@ type BarTracks []BarEvents
 // considered a "song"... or several measures of different snippets of ideas
 // These are played in order
 type SongSnippet struct {
-	Instr  gm.Instr
-	Tracks []BarTracks
+	Part    Part
+	Channel uint8
+	Instr   gm.Instr
+	Tracks  []BarTracks
 }
 
-// resolution: 96 ticks per quarternote 960 is also common
-var ticksPerQ = 480
-var clock = smf.MetricTicks(ticksPerQ)
+// Part is one of the kinds of thing we can generate
+type Part int
 
-var lastNotePerlin = 2.0
-var plin *perlin.Perlin
-
-func Alloc() {
-	//                   [ sharps                     ] [ flats                          ]
-	//                0    1    2    3    4    5    6     7     8     9    10   11     12
-	//                0    -    -    -    -    -    -     +     +     +	    +    +     +
-	key = [13]string{"C", "G", "D", "A", "E", "B", "F#", "F", "Bb", "Eb", "Ab", "Db", "Gb"}
-	//                  0    1    2    3    4    5    6
-	sharps = [7]string{"F", "C", "G", "D", "A", "E", "B"}
-	//                  0     1     2      3    4     5     6
-	degree = [7]string{"I", "II", "III", "IV", "V", "VI", "VII°"}
-	//                    0    1    2    3    4    5    6
-	interval = [7]string{"M", "m", "m", "M", "M", "m", "°"}
-	seventh = [7]string{"∆7", "-7", "-7", "∆7", "7", "-7", "°7"}
-	//                 0   1   2   3   4   5   6
-	notes = [7]string{"A", "B", "C", "D", "E", "F", "G"}
-
-	midiMap = map[string]uint8{
-		"B#": 60,
-		"C":  60,
-		"C#": 61,
-		"Db": 61,
-		"D":  62,
-		"D#": 63,
-		"Eb": 63,
-		"E":  64,
-		"Fb": 64,
-		"E#": 65,
-		"F":  65,
-		"F#": 66,
-		"Gb": 66,
-		"G":  67,
-		"G#": 68,
-		"Ab": 68,
-		"A":  69,
-		"A#": 70,
-		"Bb": 70,
-		"B":  71,
-		"Cb": 71,
+const (
+	PartChords Part = 0
+	PartDrums  Part = 1
+	PartBass   Part = 2
+	PartMelody Part = 3
+	PartSong   Part = 4
+	PartArp    Part = 5
+)
+
+func (p Part) String() string {
+	switch p {
+	case PartChords:
+		return "chords"
+	case PartDrums:
+		return "drums"
+	case PartBass:
+		return "bass"
+	case PartMelody:
+		return "melody"
+	case PartSong:
+		return "song"
+	case PartArp:
+		return "arp"
 	}
+	return fmt.Sprintf("part%d", int(p))
+}
 
-	lastNotePerlin = RandomPerlinPos()
-	rand.Seed(time.Now().UnixNano())
+// ParsePart turns a part name ("bass") or number ("2") into a Part
+func ParsePart(name string) (Part, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for p := PartChords; p <= PartArp; p++ {
+		if name == p.String() || name == fmt.Sprintf("%d", int(p)) {
+			return p, nil
+		}
+	}
+	return PartChords, fmt.Errorf("unknown part: %v", name)
+}
 
-	alpha := 2.0
-	beta := 2.0
-	n := int32(3)
-	const MaxInt = int(^uint(0) >> 1)
-	seed := rand.Intn(MaxInt)
-	plin = perlin.NewPerlin(alpha, beta, n, int64(seed))
+// Idea holds everything that is shared between the parts of a generated
+// idea so drums, bass, chords and melody all line up
+type Idea struct {
+	Tempo       float64
+	Scale       Scale
+	Meter       Meter
+	Swing       Swing
+	Bars        int
+	Phrase      int // bars in a phrase, the drums fill at the end of each one
+	Progression Progression
+	Voicing     VoicingStyle
+	Arp         Arpeggio
+	Jazz        bool // sevenths in random progressions, drop 2 and drop 3 voicings
+	Bass        BassStyle
+	Drums       DrumStyle
+	Melody      MelodyStyle
+	MelodyRange MelodyRange
+	// the scale the melody and bass lines pick their notes from, the scale
+	// of the key if it has no notes
+	MelodyScale Scale
+	// how the melody and piano chords are held from one note to the next
+	Articulation Articulation
+	Humanize     map[Part]Humanize
 }
 
-// Anything after B will need an octave boost to go
-// up instead of staying in the lower mid range
-func Oct(note uint8, octave int8) uint8 {
-	res := note + uint8(12*octave)
-	if res > 127 {
-		res -= 12
+// resolution: 96 ticks per quarternote 960 is also common
+var ticksPerQ = 480
+var clock = smf.MetricTicks(ticksPerQ)
+
+// Generator owns all the random state used when making an idea. Two
+// generators made with the same seed will make the same midi when given
+// the same parameters
+type Generator struct {
+	Seed int64
+	rand *rand.Rand
+}
+
+// NewGenerator creates a generator seeded with seed
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		Seed: seed,
+		rand: rand.New(rand.NewSource(seed)),
 	}
-	return res
+}
+
+// NewSeed picks a seed for when one was not asked for
+func NewSeed() int64 {
+	return time.Now().UnixNano()
 }
 
 // Give a tonic and a number of accidentals this returns
 // the notes of a scale (or the Triad Chords depending on how you)
-// look at it.
-func Chords(tonic int, numAccidentals int, flats bool) [7]string {
+// look at it. The notes go up from the tonic in octave 4
+func Chords(tonic int, numAccidentals int, flats bool) [7]Pitch {
 
-	var inharmonic [7]string
+	var inharmonic [7]Pitch
 
 	///////
 	// Get our lookup tables for accidentals
@@ -167,9 +227,9 @@ func Chords(tonic int, numAccidentals int, flats bool) [7]string {
 	///////
 
 	///////
-	strAccidental := "#"
+	var accidental int8 = 1
 	if flats {
-		strAccidental = "b"
+		accidental = -1
 	}
 	///////
 
@@ -177,10 +237,9 @@ func Chords(tonic int, numAccidentals int, flats bool) [7]string {
 	i := 0
 	for i < 7 {
 
+		inharmonic[i] = Pitch{Letter: notes[tonic][0]}
 		if Contains(accidentals, notes[tonic]) {
-			inharmonic[i] = fmt.Sprintf("%s%s", notes[tonic], strAccidental)
-		} else {
-			inharmonic[i] = fmt.Sprintf("%v", notes[tonic])
+			inharmonic[i].Accidental = accidental
 		}
 
 		i++
@@ -192,6 +251,7 @@ func Chords(tonic int, numAccidentals int, flats bool) [7]string {
 	}
 	///////
 
+	ascending(inharmonic[:], 4)
 	return inharmonic
 }
 
@@ -235,124 +295,47 @@ func ScaleDegrees(pos Mode) ([7]string, [7]string, [7]string) {
 	return degrees, triTones, seventhTones
 }
 
-const (
-	BiasNone        = 0
-	BiasOne         = 1
-	BiasOneAndThree = 257
-	BiasTwoAndFour  = 4112
-	Bias4th         = 4369
-	Bias8th         = 21845
-)
-
-// Beats are marked backwards
-//                <---
-// 0000 0000 0000 0000
-//
-// So for example:
-// 0000 0001 0000 0001 =  257 = 1 & 3
-// 0001 0000 0001 0000 = 4112 = 2 & 4
-func GenerateRhythm(bias uint16) uint16 {
-	max := 65535
-	min := 0
-	beat := uint16(rand.Intn(max-min) + min)
-	return uint16(beat | bias)
-}
-
-func GenerateTempo() uint8 {
+func (g *Generator) GenerateTempo() uint8 {
 	max := 150
 	min := 60
-	v := rand.Intn(max-min) + min
+	v := g.rand.Intn(max-min) + min
 	return uint8(v)
 }
 
-func RandomNote(scale [7]string) (string, int8) {
-	notePrefs := []int8{
-		0, 1, 2, 3, 4, 5, 6,
-		// 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // root
-		// 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, // 3rd
-		// 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, // 3rd
-		// 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, // 5th
-		// 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, // 5th
-		// 1, 1, 1, 1, 1, 5, 5, 5, 5, 5, // 2nd & 6th
-		// 3, 3, 3, 3, 3, 3, 3, 6, 6, 6, // 4th & 7th
-	}
-
-	loc := int8(math.Abs(plin.Noise1D(lastNotePerlin)*100)) % int8(len(notePrefs))
-	lastNotePerlin += .01
-
-	// this is here if we want to try to control the percentage of
-	// particular notes
-	notePos := notePrefs[loc]
-
-	// * | * | * |
-	// 1 2 3 4 5 6 7
-	// 0 1 2 3 4 5 6
-	return scale[notePos], notePos
-}
-
-func RandomPerlinPos() float64 {
-	return rand.Float64()
-}
-
-func RandomFromSlice(list []int8) int8 {
+func (g *Generator) RandomFromSlice(list []int8) int8 {
 	max := len(list)
 	min := 0
-	v := rand.Intn(max-min) + min
+	v := g.rand.Intn(max-min) + min
 	return list[v]
 }
 
-func RandomOctave() int8 {
-	octaves := []int8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 2}
-	return RandomFromSlice(octaves)
-}
-
-func RandomChordExtension() int8 {
-	extensions := []int8{2, 4, 6, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7}
-	return RandomFromSlice(extensions)
-}
-
 // RandMidiRange pick a number that can be used within a midi message
-func RandMidiRange(min int, max int) uint8 {
-	v := rand.Intn(max-min) + min
+func (g *Generator) RandMidiRange(min int, max int) uint8 {
+	v := g.rand.Intn(max-min) + min
 	return uint8(v)
 }
 
-func GenerateScale(wantKey int) Scale {
-	if wantKey > 12 {
-		panic("Not enough notes for that")
+// GenerateScale makes the scale for the key signature at wantKey rotated to
+// start on the degree for mode. For example key 0 (C) in Dorian is
+// D E F G A B C
+func GenerateScale(wantKey int, mode Mode) (Scale, error) {
+	if wantKey < 0 || wantKey >= len(keySignatures) {
+		return Scale{}, fmt.Errorf("no key signature for key %d", wantKey)
 	}
-
-	songKey := key[wantKey]
-	sharpOrFlat := 0
-	numSharps := 0
-	mod := 1
-	if len(songKey) > 1 {
-		sf := songKey[1]
-		// 98 is b, it's flat
-		if sf == 98 {
-			mod = 6
-			wantKey++
-		}
-		sharpOrFlat = 7 % mod
-		numSharps = wantKey % 7
-	} else if songKey == "F" {
-		mod = 6
-		sharpOrFlat = 1
-		numSharps = 1
-	} else {
-		sharpOrFlat = 7 % mod
-		numSharps = wantKey % 7
+	if mode < Ionian || mode > Locrian {
+		return Scale{}, fmt.Errorf("unknown mode: %v", mode)
 	}
 
-	useFlats := false
-	if sharpOrFlat == 1 {
-		useFlats = true
-	}
+	sig := keySignatures[wantKey]
+	noteIndex := int(sig.Major[0] - 'A')
+	major := Chords(noteIndex, int(sig.Accidentals), sig.UseFlats)
 
-	noteIndex := int((songKey[0] % 64) - 1)
-	scale := Chords(noteIndex, numSharps, useFlats)
+	var scale [7]Pitch
+	for i := 0; i < 7; i++ {
+		scale[i] = major[(i+int(mode))%7]
+	}
 
-	return Scale{scale, uint8(numSharps), useFlats}
+	return Scale{ascending(scale[:], 4), sig.Accidentals, sig.UseFlats, mode}, nil
 }
 
 // func DisplayModes() {
@@ -409,244 +392,303 @@ func GenerateScale(wantKey int) Scale {
 // 	fmt.Printf("\n")
 // }
 
-// Generate one bar of music with 16th note fidelity
-func randomBarEvents(scale Scale, jazz bool) BarEvents {
-	// var barEvents []BarEvent
-	var notes = make([]BarEvent, 16)
+// Generate one bar of chords with 16th note fidelity. A chord is always
+// played when the progression changes chord. Pads hold each chord until the
+// next one, a guitar strums a random rhythm on the 8th notes and a piano
+// comps a random rhythm on the 16ths
+func (g *Generator) randomBarEvents(idea Idea, v *voicer, bar int) BarEvents {
+	meter := idea.Meter
+	prog := idea.Progression
+	steps := meter.Steps()
+	var notes = make([]BarEvent, steps)
 	// 1 e + a 2 e + a 3 e + a 4 e + a
 	// 0 1 2 3 4 5 6 7 8 9 A B C D E F
-	t := GenerateRhythm(Bias4th)
-	for i := 0; i < 16; i++ {
-		on := (t >> i) & 1
-		if on == 1 {
-			rootNote, degree := RandomNote(scale.Notes)
-			notes[i] = BarEvent{[]uint8{
-				Oct(midiMap[rootNote], RandomOctave()),
-				Oct(midiMap[scale.Notes[(degree+3)%7]], RandomOctave()),
-				Oct(midiMap[scale.Notes[(degree+5)%7]], RandomOctave()),
-			}, clock.Ticks16th(), RandMidiRange(50, 110)}
-
-			if jazz {
-				notes[i].Keys = append(
-					notes[i].Keys,
-					Oct(midiMap[scale.Notes[(degree+RandomChordExtension())%7]], RandomOctave()),
-				)
+	t := g.GenerateRhythm(meter.BiasPulse())
+	for i := 0; i < steps; i++ {
+		notes[i] = BarEvent{[]uint8{0}, clock.Ticks16th(), 0, 0}
+
+		change := prog.ChangesAt(i, steps)
+		switch v.style {
+		case VoicingPad:
+			if !change {
+				continue
+			}
+			// a chord that carries on over the barline was tied from the
+			// bar before, so it isn't played again
+			chord := prog.At(bar, i, steps)
+			if i == 0 && bar > 0 && sameChord(idea.Scale, prog.At(bar-1, steps-1, steps), chord) {
+				continue
+			}
+			length := 1
+			for i+length < steps && !prog.ChangesAt(i+length, steps) {
+				length++
+			}
+			notes[i] = BarEvent{
+				v.voice(idea.Scale, chord),
+				padLength(idea, bar, i, length, chord),
+				g.RandMidiRange(60, 85),
+				0,
 			}
+			continue
+		case VoicingGuitar:
+			if i%2 == 1 && !change {
+				continue
+			}
+		}
 
-		} else {
-			notes[i] = BarEvent{[]uint8{0}, clock.Ticks16th(), 0}
+		if t[i] || change {
+			chord := prog.At(bar, i, steps)
+			notes[i] = BarEvent{
+				v.voice(idea.Scale, chord),
+				clock.Ticks16th(),
+				g.RandMidiRange(50, 110),
+				0,
+			}
 		}
 	}
+
+	switch v.style {
+	case VoicingPiano:
+		articulate(notes, idea.Articulation)
+	case VoicingGuitar:
+		articulate(notes, Staccato)
+	}
 	return notes
 }
 
-func RandomChords(tempo float64, scale Scale, bars int, jazz bool) []byte {
-	beatPerBar := 4
-	channel := 0
-
-	var snippet SongSnippet
-	snippet.Tracks = make([]BarTracks, bars)
+// padLength how long a pad chord starting on step i of a bar is held. It
+// lasts length steps, and if it is the last chord of the bar it is tied
+// over into the bars after for as long as the chord doesn't change
+func padLength(idea Idea, bar int, i int, length int, chord Chord) uint32 {
+	prog := idea.Progression
+	steps := idea.Meter.Steps()
+	ticks := uint32(length) * Sixteenth
+	if i+length < steps {
+		return ticks
+	}
 
-	for m := 0; m < bars; m++ {
-		var track BarTracks
-		track = append(track, randomBarEvents(scale, jazz))
-		snippet.Tracks[m] = track
+	first := 1
+	for first < steps && !prog.ChangesAt(first, steps) {
+		first++
 	}
+	for next := bar + 1; next < idea.Bars && sameChord(idea.Scale, prog.At(next, 0, steps), chord); next++ {
+		ticks = Tied(ticks, uint32(first)*Sixteenth)
+		if first < steps {
+			break
+		}
+	}
+	return ticks
+}
 
-	snippet.Instr = gm.Instr_ElectricGuitarJazz
-	return mkSMF(uint8(channel), tempo, uint8(beatPerBar), scale, snippet)
+// sameChord true if two chords are spelled the same in the scale
+func sameChord(scale Scale, a Chord, b Chord) bool {
+	return scale.Numeral(a) == scale.Numeral(b)
 }
 
-func RandomBass(tempo float64, scale Scale, bars int) []byte {
-	beatPerBar := 4
-	channel := 0
+// Generate the midi file of one part of an idea
+func (g *Generator) Generate(part Part, idea Idea) []byte {
+	switch part {
+	case PartDrums:
+		return g.RandomBeat(idea)
+	case PartBass:
+		return g.RandomBass(idea)
+	case PartMelody:
+		return g.RandomMelody(idea)
+	case PartSong:
+		return g.RandomSong(idea)
+	case PartArp:
+		return g.RandomArp(idea)
+	}
+	return g.RandomChords(idea)
+}
+
+func (g *Generator) RandomChords(idea Idea) []byte {
+	return mkSMF(idea, g.humanize(idea, g.chordSnippet(idea)))
+}
 
+func (g *Generator) chordSnippet(idea Idea) SongSnippet {
 	var snippet SongSnippet
-	snippet.Tracks = make([]BarTracks, bars)
+	snippet.Tracks = make([]BarTracks, idea.Bars)
 
-	for m := 0; m < bars; m++ {
+	v := &voicer{style: idea.Voicing, jazz: idea.Jazz}
+	for m := 0; m < idea.Bars; m++ {
 		var track BarTracks
-		var tune = make([]BarEvent, 16)
-		// 1 e + a 2 e + a 3 e + a 4 e + a
-		// 0 1 2 3 4 5 6 7 8 9 A B C D E F
-		t := GenerateRhythm(BiasOne)
-		for i := 0; i < 16; i++ {
-			on := (t >> i) & 1
-			if on == 1 {
-				note, _ := RandomNote(scale.Notes)
-				tune[i] = BarEvent{[]uint8{
-					Oct(midiMap[note], -2+-RandomOctave()),
-				}, clock.Ticks16th(), RandMidiRange(80, 110)}
-			} else {
-				tune[i] = BarEvent{[]uint8{0}, clock.Ticks16th(), 0}
-			}
-		}
-		track = append(track, tune)
-
+		track = append(track, g.randomBarEvents(idea, v, m))
 		snippet.Tracks[m] = track
 	}
 
-	snippet.Instr = gm.Instr_ElectricBassFinger
-	return mkSMF(uint8(channel), tempo, uint8(beatPerBar), scale, snippet)
+	snippet.Part = PartChords
+	snippet.Channel = 0
+	switch idea.Voicing {
+	case VoicingPad:
+		snippet.Instr = gm.Instr_Pad2Warm
+	case VoicingGuitar:
+		snippet.Instr = gm.Instr_ElectricGuitarJazz
+	default:
+		snippet.Instr = gm.Instr_AcousticGrandPiano
+	}
+	return snippet
 }
 
-func RandomMelody(tempo float64, scale Scale, bars int) []byte {
-	beatPerBar := 4
-	channel := 0
+func (g *Generator) RandomBass(idea Idea) []byte {
+	return mkSMF(idea, g.humanize(idea, g.bassSnippet(idea)))
+}
 
+func (g *Generator) bassSnippet(idea Idea) SongSnippet {
 	var snippet SongSnippet
-	snippet.Tracks = make([]BarTracks, bars)
+	snippet.Tracks = make([]BarTracks, idea.Bars)
 
-	for m := 0; m < bars; m++ {
+	for m := 0; m < idea.Bars; m++ {
 		var track BarTracks
-		var tune = make([]BarEvent, 16)
-		// 1 e + a 2 e + a 3 e + a 4 e + a
-		// 0 1 2 3 4 5 6 7 8 9 A B C D E F
-		t := GenerateRhythm(Bias4th)
-		for i := 0; i < 16; i++ {
-			on := (t >> i) & 1
-			if on == 1 {
-				note, _ := RandomNote(scale.Notes)
-				tune[i] = BarEvent{[]uint8{
-					Oct(midiMap[note], RandomOctave()),
-				}, clock.Ticks16th(), RandMidiRange(80, 110)}
-			} else {
-				tune[i] = BarEvent{[]uint8{0}, clock.Ticks16th(), 0}
-			}
-		}
-		track = append(track, tune)
-
+		track = append(track, g.bassBarEvents(idea, m))
 		snippet.Tracks[m] = track
 	}
 
-	snippet.Instr = gm.Instr_DistortionGuitar
-	return mkSMF(uint8(channel), tempo, uint8(beatPerBar), scale, snippet)
+	snippet.Part = PartBass
+	snippet.Channel = 1
+	snippet.Instr = gm.Instr_ElectricBassFinger
+	return snippet
 }
 
-func RandomBeat(tempo float64, scale Scale, bars int) []byte {
-	beatPerBar := 4
-	channel := 9 // midi defined drum track
+func (g *Generator) RandomMelody(idea Idea) []byte {
+	return mkSMF(idea, g.humanize(idea, g.melodySnippet(idea)))
+}
 
-	var snippet SongSnippet
-	snippet.Tracks = make([]BarTracks, bars)
-
-	for m := 0; m < bars; m++ {
-		////////////////////////////////////////////////
-		var tracks BarTracks
-
-		var kick = make([]BarEvent, 16)
-		// 1 e + a 2 e + a 3 e + a 4 e + a
-		// 0 1 2 3 4 5 6 7 8 9 A B C D E F
-		k := GenerateRhythm(BiasOneAndThree)
-		for i := 0; i < 16; i++ {
-			on := (k >> i) & 1
-			if on == 1 {
-				kick[i] = BarEvent{[]uint8{gm.DrumKey_AcousticBassDrum.Key()}, clock.Ticks16th(), RandMidiRange(70, 110)}
-			}
-		}
+func (g *Generator) RandomBeat(idea Idea) []byte {
+	return mkSMF(idea, g.humanize(idea, g.beatSnippet(idea)))
+}
 
-		var snare = make([]BarEvent, 16)
-		s := GenerateRhythm(BiasTwoAndFour)
-		for i := 0; i < 16; i++ {
-			on := (s >> i) & 1
-			if on == 1 {
-				snare[i] = BarEvent{[]uint8{gm.DrumKey_AcousticSnare.Key()}, clock.Ticks16th(), RandMidiRange(0, 100)}
-			}
-		}
+func (g *Generator) beatSnippet(idea Idea) SongSnippet {
+	style := idea.Drums.In(idea.Meter)
+	if len(style.Voices) == 0 {
+		style = basicStyle(idea.Meter)
+	}
 
-		var highhat = make([]BarEvent, 16)
-		h := GenerateRhythm(Bias4th)
-		for i := 0; i < 16; i++ {
-			on := (h >> i) & 1
-			if on == 1 {
-				highhat[i] = BarEvent{[]uint8{gm.DrumKey_ClosedHiHat.Key()}, clock.Ticks16th(), RandMidiRange(0, 100)}
-			}
-		}
+	var snippet SongSnippet
+	snippet.Tracks = make([]BarTracks, idea.Bars)
 
-		tracks = append(tracks, kick)
-		tracks = append(tracks, snare)
-		tracks = append(tracks, highhat)
-		////////////////////////////////////////////////
-		snippet.Tracks[m] = tracks
+	var groove []Rhythm
+	for m := 0; m < idea.Bars; m++ {
+		if m%phraseLength(idea) == 0 {
+			groove = g.drumGroove(idea, style)
+		}
+		snippet.Tracks[m] = g.drumBarTracks(idea, style, groove, m)
 	}
 
+	snippet.Part = PartDrums
+	snippet.Channel = 9 // midi defined drum track
 	snippet.Instr = gm.Instr_SynthDrum
-	return mkSMF(uint8(channel), tempo, uint8(beatPerBar), scale, snippet)
+	return snippet
 }
 
-// makes a SMF and returns the bytes
-func mkSMF(channel uint8, tempo float64, beatPerBar uint8, scale Scale, snippet SongSnippet) []byte {
-	var (
-		bf bytes.Buffer
-		tr smf.Track
-		ch = channel
+// RandomSong makes drums, bass, chords and melody that all share the same
+// tempo, key and number of bars, and returns them as one multi track SMF
+func (g *Generator) RandomSong(idea Idea) []byte {
+	return mkSMF(idea,
+		g.humanize(idea, g.beatSnippet(idea)),
+		g.humanize(idea, g.bassSnippet(idea)),
+		g.humanize(idea, g.chordSnippet(idea)),
+		g.humanize(idea, g.melodySnippet(idea)),
 	)
+}
+
+// makes a SMF and returns the bytes. One snippet makes a single track
+// file, more than one makes a multi track (format 1) file with a track
+// for the tempo and meter followed by a track per snippet
+func mkSMF(idea Idea, snippets ...SongSnippet) []byte {
+	var bf bytes.Buffer
+	var s *smf.SMF
+
+	if len(snippets) == 1 {
+		s = smf.New()
+		s.TimeFormat = clock
+
+		var tr smf.Track
+		addMeta(&tr, idea)
+		rest := addSnippet(&tr, idea, snippets[0])
+		tr.Close(rest)
+		s.Add(tr)
+	} else {
+		s = smf.NewSMF1()
+		s.TimeFormat = clock
+
+		// first track must have tempo and meter information
+		var meta smf.Track
+		addMeta(&meta, idea)
+		meta.Close(0)
+		s.Add(meta)
+
+		for _, snippet := range snippets {
+			var tr smf.Track
+			tr.Add(0, smf.MetaTrackSequenceName(snippet.Part.String()))
+			rest := addSnippet(&tr, idea, snippet)
+			tr.Close(rest)
+			s.Add(tr)
+		}
+	}
+
+	s.WriteTo(&bf)
+	return bf.Bytes()
+}
+
+// addMeta adds the tempo, meter and key information to a track
+func addMeta(tr *smf.Track, idea Idea) {
+	scale := idea.Scale
+	meter := idea.Meter
+	tr.Add(0, smf.MetaTempo(idea.Tempo))
+	tr.Add(0, smf.MetaTimeSig(meter.Beats, meter.Value, meter.ClocksPerClick(), 8))
+	tr.Add(0, smf.MetaKey(0, scale.Mode.IsMajor(), scale.Accidentals, scale.UseFlats))
+}
+
+// addSnippet adds the instrument and all the notes of a snippet to a track.
+// Returns how many ticks are left from the last event to the end of the
+// last bar
+func addSnippet(tr *smf.Track, idea Idea, snippet SongSnippet) uint32 {
+	ch := snippet.Channel
+	steps := idea.Meter.Steps()
+	barTicks := uint32(steps) * clock.Ticks16th()
 
-	// first track must have tempo and meter information
-	tr.Add(0, smf.MetaMeter(beatPerBar, 4))
-	tr.Add(0, smf.MetaTempo(tempo))
-	tr.Add(0, smf.MetaTimeSig(beatPerBar, 4, 0, 0))
-	tr.Add(0, smf.MetaKey(0, true, scale.Accidentals, scale.UseFlats))
 	tr.Add(0, smf.MetaInstrument(snippet.Instr.String()))
-	tr.Add(0, midi.ProgramChange(0, snippet.Instr.Value()))
-
-	// because delta time
-	for b := 0; b < len(snippet.Tracks); b++ {
-		beat := 0
-		barEvents := snippet.Tracks[b]
-		for i := 0; i < (ticksPerQ * int(beatPerBar)); i++ {
-
-			// when a 16th note happens...
-			if i%int(clock.Ticks16th()) == 0 {
-				// loop over the array of events that could be happening in this *bar*
-				for be := 0; be < len(barEvents); be++ {
-					// grab one event, this may have several events in it - like a track
-					events := barEvents[be]
-					// a "track" could have lots of keys (notes) aka a chord
-					for e := 0; e < len(events); e++ {
-						if beat == e && events[e].Keys != nil {
-							// Should only send the note off with a length message once
-							// and all others with note off 0 offset
-							// All the NoteOns on this beat...
-							for k := 0; k < len(events[e].Keys); k++ {
-								if events[e].Keys[k] != 0 {
-									tr.Add(0, midi.NoteOn(ch, events[e].Keys[k], events[e].Velocity))
-								}
-							}
-
-							// Then all the NoteOffs for this beat...
-							off := false
-							for k := 0; k < len(events[e].Keys); k++ {
-								// if this is not the drum channel, respect note length
-								// else we just note off on zero like we do for other notes
-								// in this chord
-								if channel != 9 && !off {
-									tr.Add(events[e].Length, midi.NoteOff(ch, 0))
-									off = true
-								}
-								tr.Add(0, midi.NoteOff(ch, events[e].Keys[k]))
-							}
-						}
-					}
-				}
+	tr.Add(0, midi.ProgramChange(ch, snippet.Instr.Value()))
+
+	at := func(pos uint32) uint32 {
+		bar := pos / barTicks
+		return bar*barTicks + idea.Swing.Tick(pos%barTicks)
+	}
 
-				// This ensures everything sticks to a 16th note grid. It make extra events,
-				// but that doesn't seem to hurt anything
-				if channel == 9 {
-					tr.Add(clock.Ticks16th(), midi.NoteOff(ch, 0))
+	shift := func(tick uint32, offset int32) uint32 {
+		if offset < 0 && uint32(-offset) > tick {
+			return 0
+		}
+		return uint32(int64(tick) + int64(offset))
+	}
+
+	// notes can be held past the last bar (tied or legato), but the idea
+	// still has to end on time to loop
+	sched := newSchedule(ch, uint32(len(snippet.Tracks))*barTicks)
+	for b, barEvents := range snippet.Tracks {
+		barStart := uint32(b) * barTicks
+		for _, events := range barEvents {
+			for beat, event := range events {
+				if beat >= steps {
+					break
+				}
+				pos := barStart + uint32(beat)*clock.Ticks16th()
+				start := shift(at(pos), event.Offset)
+
+				// if this is not the drum channel, respect note length
+				// else we just note off straight away
+				off := start
+				if ch != 9 {
+					off = shift(at(pos+event.Length), event.Offset)
+				}
+				for _, key := range event.Keys {
+					sched.note(start, off, key, event.Velocity)
 				}
-				beat++
 			}
 		}
 	}
-	tr.Close(0)
-
-	// create the SMF and add the tracks
-	s := smf.New()
-	s.TimeFormat = clock
-	s.Add(tr)
-	s.WriteTo(&bf)
-	return bf.Bytes()
+	return sched.write(tr)
 }
 
 // Generate midi files. The number of bars will be the length of the
@@ -0,0 +1,91 @@
+package songmatic
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSameSeedSameMidi(t *testing.T) {
+	idea := testIdea(Meter44, Straight)
+	idea.Humanize[PartArp] = DefaultHumanize(1)
+	idea.Drums, _ = ParseDrumStyle("")
+	idea.Arp = Arpeggio{Direction: ArpRandom, Rate: Arp16th, Octaves: 2}
+	idea.Melody = MelodyMotif
+	idea.MelodyRange = DefaultMelodyRange
+
+	tests := []struct {
+		part  Part
+		seed  int64
+		other int64
+	}{
+		{PartChords, 1, 2},
+		{PartDrums, 1, 2},
+		{PartBass, 1, 2},
+		{PartMelody, 1, 2},
+		{PartSong, 1, 2},
+		{PartArp, 1, 2},
+		{PartMelody, -7, 1 << 40},
+	}
+	for _, tt := range tests {
+		first := NewGenerator(tt.seed).Generate(tt.part, idea)
+		second := NewGenerator(tt.seed).Generate(tt.part, idea)
+		if !bytes.Equal(first, second) {
+			t.Errorf("%v seed %d: two generators made different midi", tt.part, tt.seed)
+		}
+		other := NewGenerator(tt.other).Generate(tt.part, idea)
+		if bytes.Equal(first, other) {
+			t.Errorf("%v: seeds %d and %d made the same midi", tt.part, tt.seed, tt.other)
+		}
+	}
+}
+
+func TestTritoneSubLines(t *testing.T) {
+	idea := testIdea(Meter44, Straight)
+	idea.Progression, _ = ParseProgression("subV7", 1)
+	idea.Melody = MelodyChordTones
+	idea.MelodyRange = DefaultMelodyRange
+
+	// subV7 in C is Db7, Db F Ab Cb
+	db7 := map[uint8]bool{1: true, 5: true, 8: true, 11: true}
+
+	for _, style := range []BassStyle{BassRoot, BassRootFifth, BassWalking, BassOctave} {
+		idea.Bass = style
+		for seed := int64(1); seed <= 5; seed++ {
+			snippet := NewGenerator(seed).bassSnippet(idea)
+			for b, bar := range snippet.Tracks {
+				for _, events := range bar {
+					for i, event := range events {
+						key := event.Keys[0]
+						if key == 0 {
+							continue
+						}
+						if i == 0 && key%12 != 1 {
+							t.Errorf("%v seed %d bar %d: want the bar to start on Db, got %v", style, seed, b, PitchFromMidi(key, true))
+						}
+						// walking lines pass through notes between the chord tones
+						if style != BassWalking && !db7[key%12] {
+							t.Errorf("%v seed %d bar %d step %d: %v is not in Db7", style, seed, b, i, PitchFromMidi(key, true))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// the melody lands on the notes of Db7 that are in C major, F and B
+	pulse := idea.Meter.BiasPulse()
+	for seed := int64(1); seed <= 5; seed++ {
+		snippet := NewGenerator(seed).melodySnippet(idea)
+		for b, bar := range snippet.Tracks {
+			for i, event := range bar[0] {
+				key := event.Keys[0]
+				if !pulse[i] || key == 0 {
+					continue
+				}
+				if key%12 != 5 && key%12 != 11 {
+					t.Errorf("seed %d bar %d step %d: melody plays %v on the beat over Db7", seed, b, i, PitchFromMidi(key, true))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package songmatic
+
+import (
+	"gitlab.com/gomidi/midi/v2/gm"
+)
+
+// Humanize how much a part is loosened up so it sounds less like a machine
+type Humanize struct {
+	// most ticks a note can be pushed early or late
+	Timing uint32
+	// most a note's velocity can move up or down
+	Velocity uint8
+	// louder downbeats, softer off beats and ghost notes on the snare
+	Accents bool
+}
+
+// DefaultHumanize a humanize setting from an amount between 0 (none) and 1
+// (a lot)
+func DefaultHumanize(amount float64) Humanize {
+	if amount <= 0 {
+		return Humanize{}
+	}
+	if amount > 1 {
+		amount = 1
+	}
+	return Humanize{
+		// never more than a 32nd either way so notes stay on their own step
+		Timing:   uint32(amount * float64(clock.Ticks32th())),
+		Velocity: uint8(amount * 20),
+		Accents:  true,
+	}
+}
+
+// humanize loosens up the timing and velocity of a snippet using the
+// Humanize settings in the idea for the snippet's part
+func (g *Generator) humanize(idea Idea, snippet SongSnippet) SongSnippet {
+	h, ok := idea.Humanize[snippet.Part]
+	if !ok || (h == Humanize{}) {
+		return snippet
+	}
+
+	meter := idea.Meter
+	kick := meter.BiasKick()
+	snare := meter.BiasSnare()
+	pulse := meter.BiasPulse()
+	count := meter.BiasCount()
+
+	for _, bar := range snippet.Tracks {
+		for _, events := range bar {
+			for step := range events {
+				event := &events[step]
+				if event.Keys == nil || event.Velocity == 0 {
+					continue
+				}
+
+				velocity := int(event.Velocity)
+				if h.Accents {
+					velocity = accent(snippet.Part, event.Keys[0], velocity, step, kick, snare, pulse, count)
+				}
+				if h.Velocity > 0 {
+					velocity += g.rand.Intn(2*int(h.Velocity)+1) - int(h.Velocity)
+				}
+				if velocity < 1 {
+					velocity = 1
+				}
+				if velocity > 127 {
+					velocity = 127
+				}
+				event.Velocity = uint8(velocity)
+
+				if h.Timing > 0 {
+					event.Offset += int32(g.rand.Intn(2*int(h.Timing)+1)) - int32(h.Timing)
+				}
+			}
+		}
+	}
+	return snippet
+}
+
+// accent makes a velocity louder (or softer) because of where the note
+// falls in the bar and what is playing it
+func accent(part Part, key uint8, velocity int, step int, kick, snare, pulse, count Rhythm) int {
+	// Where the note falls in the bar
+	var curve int
+	switch {
+	case step == 0:
+		curve = 15
+	case pulse[step]:
+		curve = 8
+	case count[step]:
+		curve = 3
+	case step%2 == 0:
+		curve = -4
+	default:
+		curve = -10
+	}
+
+	switch part {
+	case PartDrums:
+		// DrumKey.Key() is the drum number plus one, so undo that here
+		switch gm.DrumKey(key - 1) {
+		case gm.DrumKey_AcousticBassDrum, gm.DrumKey_BassDrum1:
+			if kick[step] {
+				return velocity + curve + 10
+			}
+			return velocity + curve
+		case gm.DrumKey_AcousticSnare, gm.DrumKey_ElectricSnare:
+			// snares off the back beat become ghost notes
+			if snare[step] {
+				return velocity + 15
+			}
+			return 20 + velocity/5
+		case gm.DrumKey_ClosedHiHat, gm.DrumKey_PedalHiHat, gm.DrumKey_RideCymbal1:
+			return velocity + curve/2
+		}
+		return velocity + curve
+	case PartBass:
+		return velocity + curve
+	case PartChords:
+		return velocity + curve/2
+	}
+	return velocity + curve/3
+}
@@ -0,0 +1,70 @@
+package songmatic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeySignature a major key, its relative minor, and the sharps or flats
+// written at the start of the staff
+type KeySignature struct {
+	Major       string
+	Minor       string
+	Accidentals uint8
+	UseFlats    bool
+}
+
+// All 15 key signatures. The first 13 are in the order the key numbers have
+// always been given in on /download, C# and Cb are added on the end
+var keySignatures = [15]KeySignature{
+	{"C", "Am", 0, false},
+	{"G", "Em", 1, false},
+	{"D", "Bm", 2, false},
+	{"A", "F#m", 3, false},
+	{"E", "C#m", 4, false},
+	{"B", "G#m", 5, false},
+	{"F#", "D#m", 6, false},
+	{"F", "Dm", 1, true},
+	{"Bb", "Gm", 2, true},
+	{"Eb", "Cm", 3, true},
+	{"Ab", "Fm", 4, true},
+	{"Db", "Bbm", 5, true},
+	{"Gb", "Ebm", 6, true},
+	{"C#", "A#m", 7, false},
+	{"Cb", "Abm", 7, true},
+}
+
+// KeySignatures all the key signatures, in key number order
+func KeySignatures() []KeySignature {
+	return keySignatures[:]
+}
+
+// ParseKey reads a key by name ("Eb", "F#m") or number ("3"), and returns
+// the number of its key signature. Minor keys give the signature of their
+// relative major and true, so "F#m" is the key of A played in Aeolian
+func ParseKey(text string) (int, bool, error) {
+	text = strings.TrimSpace(text)
+	if n, err := strconv.Atoi(text); err == nil {
+		if n < 0 || n >= len(keySignatures) {
+			return 0, false, fmt.Errorf("key must be between 0 and %d: %v", len(keySignatures)-1, text)
+		}
+		return n, false, nil
+	}
+
+	name := text
+	if len(name) > 0 {
+		// so "eb" and "f#m" are the same as "Eb" and "F#m"
+		name = strings.ToUpper(name[:1]) + strings.ToLower(name[1:])
+	}
+
+	for i, k := range keySignatures {
+		if name == k.Major {
+			return i, false, nil
+		}
+		if name == k.Minor {
+			return i, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("unknown key: %v", text)
+}
@@ -0,0 +1,520 @@
+package songmatic
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2/gm"
+)
+
+// MelodyStyle how a melody picks its notes
+type MelodyStyle int
+
+const (
+	// A short motif that is repeated and developed through each phrase
+	MelodyMotif MelodyStyle = 0
+	// Chord tones of the progression on the strong beats with passing and
+	// neighbour tones in between
+	MelodyChordTones MelodyStyle = 1
+)
+
+var melodyStyleNames = [2]string{"motif", "chordtones"}
+
+func (m MelodyStyle) String() string {
+	if m < MelodyMotif || m > MelodyChordTones {
+		return fmt.Sprintf("melody%d", int(m))
+	}
+	return melodyStyleNames[m]
+}
+
+// ParseMelodyStyle turns a style name ("chordtones") or number ("1") into
+// a MelodyStyle
+func ParseMelodyStyle(name string) (MelodyStyle, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range melodyStyleNames {
+		if name == n || name == fmt.Sprintf("%d", i) {
+			return MelodyStyle(i), nil
+		}
+	}
+	return MelodyMotif, fmt.Errorf("unknown melody style: %v", name)
+}
+
+// MelodyRange the lowest and highest midi keys a melody can use
+type MelodyRange struct {
+	Low  uint8
+	High uint8
+}
+
+// DefaultMelodyRange two octaves up from middle C
+var DefaultMelodyRange = MelodyRange{60, 84}
+
+// ParseMelodyRange reads a range of midi keys written as "low-high", for
+// example "60-84". The range has to be at least an octave so every note of
+// the scale fits in it
+func ParseMelodyRange(text string) (MelodyRange, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return DefaultMelodyRange, nil
+	}
+
+	var low, high int
+	if _, err := fmt.Sscanf(text, "%d-%d", &low, &high); err != nil {
+		return DefaultMelodyRange, fmt.Errorf("unknown melody range: %v", text)
+	}
+	if low < 0 || high > 127 || high-low < 12 {
+		return DefaultMelodyRange, fmt.Errorf("melody range must be at least an octave between 0 and 127: %v", text)
+	}
+	return MelodyRange{uint8(low), uint8(high)}, nil
+}
+
+func (r MelodyRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Low, r.High)
+}
+
+// melodyRange the range of the melody in an idea, or the default range
+func melodyRange(idea Idea) MelodyRange {
+	if idea.MelodyRange == (MelodyRange{}) {
+		return DefaultMelodyRange
+	}
+	return idea.MelodyRange
+}
+
+// melodyScale the scale the melody and bass in an idea pick notes from
+func melodyScale(idea Idea) Scale {
+	if len(idea.MelodyScale.Notes) == 0 {
+		return idea.Scale
+	}
+	return idea.MelodyScale
+}
+
+// fit moves a scale index up or down octaves until its key is in the range
+func (r MelodyRange) fit(scale Scale, idx int) int {
+	n := len(scale.Notes)
+	for i := 0; i < 10 && scale.Key(idx, 0) > r.High; i++ {
+		idx -= n
+	}
+	for i := 0; i < 10 && scale.Key(idx, 0) < r.Low; i++ {
+		idx += n
+	}
+	return idx
+}
+
+// motifNote one note of a motif. Step is when it starts from the start of
+// the motif, Length how many 16th note steps it lasts and Move how far up
+// (or down) the scale it is from the motif's first note
+type motifNote struct {
+	Step   int
+	Length int
+	Move   int
+}
+
+// motif a short idea that a melody is built from
+type motif []motifNote
+
+// how far the melody moves between notes. Mostly steps, some skips and the
+// odd leap
+var contour = []int8{-1, -1, -1, 1, 1, 1, 0, -2, 2, -2, 2, -3, 3, 4, -4}
+
+// newMotif makes a motif span steps long with a rhythm that leans on the
+// pulse of the meter, and a shape that moves mostly by step. A leap is
+// followed by a step back the other way
+func (g *Generator) newMotif(idea Idea, span int) motif {
+	r := idea.Swing.Grid(g.GenerateRhythm(idea.Meter.BiasPulse()))
+	r[0] = true
+
+	// now and then two 8ths on a beat become a dotted 8th and a 16th
+	if !idea.Swing.Shuffle {
+		for _, p := range idea.Meter.Pulses() {
+			if p+3 < span && r[p] && !r[p+1] && r[p+2] && !r[p+3] && g.rand.Intn(3) == 0 {
+				r[p+2], r[p+3] = false, true
+			}
+		}
+	}
+
+	var m motif
+	move, last := 0, 0
+	for i := 0; i < span; i++ {
+		if !r[i] {
+			continue
+		}
+		if len(m) > 0 {
+			m[len(m)-1].Length = i - m[len(m)-1].Step
+		}
+		m = append(m, motifNote{i, span - i, move})
+
+		switch {
+		case last >= 3:
+			last = -1
+		case last <= -3:
+			last = 1
+		default:
+			last = int(g.RandomFromSlice(contour))
+		}
+		move += last
+	}
+	return m
+}
+
+// transpose moves the whole motif up (or down) the scale
+func (m motif) transpose(by int) motif {
+	t := make(motif, len(m))
+	for i, n := range m {
+		t[i] = motifNote{n.Step, n.Length, n.Move + by}
+	}
+	return t
+}
+
+// invert turns the shape of the motif upside down
+func (m motif) invert() motif {
+	t := make(motif, len(m))
+	for i, n := range m {
+		t[i] = motifNote{n.Step, n.Length, -n.Move}
+	}
+	return t
+}
+
+// augment plays the motif at half speed, so it takes twice as long
+func (m motif) augment() motif {
+	t := make(motif, len(m))
+	for i, n := range m {
+		t[i] = motifNote{2 * n.Step, 2 * n.Length, n.Move}
+	}
+	return t
+}
+
+// at moves the motif to start later in the bar
+func (m motif) at(step int) motif {
+	t := make(motif, len(m))
+	for i, n := range m {
+		t[i] = motifNote{n.Step + step, n.Length, n.Move}
+	}
+	return t
+}
+
+// then plays another motif after this one
+func (m motif) then(o motif) motif {
+	t := make(motif, 0, len(m)+len(o))
+	return append(append(t, m...), o...)
+}
+
+// bounds the lowest and highest moves in the motif
+func (m motif) bounds() (int, int) {
+	lo, hi := 0, 0
+	for _, n := range m {
+		if n.Move < lo {
+			lo = n.Move
+		}
+		if n.Move > hi {
+			hi = n.Move
+		}
+	}
+	return lo, hi
+}
+
+// cadence the scale index of the stable degree closest to the last note
+// played. The end of the whole melody always goes home to the tonic
+func cadence(scale Scale, last int, final bool) int {
+	n := len(scale.Notes)
+	if final {
+		return nearestDegree(last, 0, n)
+	}
+	best := nearestDegree(last, 0, n)
+	for _, d := range scale.stable() {
+		idx := nearestDegree(last, d, n)
+		if abs(idx-last) < abs(best-last) {
+			best = idx
+		}
+	}
+	return best
+}
+
+// nearestDegree the scale index closest to idx that is the degree d of a
+// scale with n notes
+func nearestDegree(idx int, d int, n int) int {
+	pos := ((idx % n) + n) % n
+	down := idx - ((pos-d)+n)%n
+	up := down + n
+	if idx-down <= up-idx {
+		return down
+	}
+	return up
+}
+
+// nearestKey the key with the same note name as key that is closest to from
+func nearestKey(from uint8, key uint8) uint8 {
+	down := int(from) - ((int(from)-int(key))%12+12)%12
+	if int(from)-down <= down+12-int(from) {
+		return midiKey(down)
+	}
+	return midiKey(down + 12)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// melodyBarEvents plays a bar of a developed motif starting from the scale
+// index base, and returns the scale index of the last note played
+func (g *Generator) melodyBarEvents(idea Idea, m motif, base int, tune BarEvents) int {
+	scale := melodyScale(idea)
+	rng := melodyRange(idea)
+
+	// keep the shape of the motif by moving it whole octaves into the range
+	// first, and only fold single notes back when it still doesn't fit
+	n := len(scale.Notes)
+	lo, hi := m.bounds()
+	for i := 0; i < 10 && scale.Key(base+hi, 0) > rng.High && scale.Key(base+lo-n, 0) >= rng.Low; i++ {
+		base -= n
+	}
+	for i := 0; i < 10 && scale.Key(base+lo, 0) < rng.Low && scale.Key(base+hi+n, 0) <= rng.High; i++ {
+		base += n
+	}
+
+	last := base
+	for _, n := range m {
+		if n.Step >= len(tune) {
+			break
+		}
+		idx := rng.fit(scale, base+n.Move)
+		velocity := g.RandMidiRange(80, 100)
+		if n.Step == 0 {
+			velocity = g.RandMidiRange(95, 110)
+		}
+		tune[n.Step] = BarEvent{
+			[]uint8{scale.Key(idx, 0)},
+			uint32(n.Length) * clock.Ticks16th(),
+			velocity,
+			0,
+		}
+		last = idx
+	}
+	return last
+}
+
+// melodySnippet builds a melody in the style asked for in the idea
+func (g *Generator) melodySnippet(idea Idea) SongSnippet {
+	var snippet SongSnippet
+	switch idea.Melody {
+	case MelodyChordTones:
+		snippet.Tracks = g.chordToneTracks(idea)
+	default:
+		snippet.Tracks = g.motifTracks(idea)
+	}
+
+	snippet.Part = PartMelody
+	snippet.Channel = 2
+	snippet.Instr = gm.Instr_DistortionGuitar
+	return snippet
+}
+
+// motifTracks builds a melody from a motif. Each phrase starts with a new
+// motif that is then repeated, moved, turned upside down or slowed down in
+// the bars that follow. The last bar of a phrase ends on a stable degree
+func (g *Generator) motifTracks(idea Idea) []BarTracks {
+	scale := melodyScale(idea)
+	steps := idea.Meter.Steps()
+	phrase := phraseLength(idea)
+	rng := melodyRange(idea)
+
+	// a motif is half a bar, kept on the 8th note grid for a shuffle
+	span := steps / 2
+	if idea.Swing.Shuffle && span%2 == 1 {
+		span--
+	}
+
+	tracks := make([]BarTracks, idea.Bars)
+
+	var m motif
+	base := 0
+	for bar := 0; bar < idea.Bars; bar++ {
+		var tune = make([]BarEvent, steps)
+		for i := range tune {
+			tune[i] = BarEvent{[]uint8{0}, clock.Ticks16th(), 0, 0}
+		}
+
+		pos := bar % phrase
+		end := pos == phrase-1 || bar == idea.Bars-1
+		if pos == 0 {
+			m = g.newMotif(idea, span)
+			// start each phrase on something stable
+			starts := append(scale.stable(), len(scale.Notes))
+			base = rng.fit(scale, starts[g.rand.Intn(len(starts))])
+		} else {
+			base = rng.fit(scale, base+int(g.RandomFromSlice([]int8{-2, -1, 0, 1, 1, 2})))
+		}
+
+		var played motif
+		switch {
+		case end:
+			played = m
+		case pos == 0:
+			played = m.then(m.transpose(int(g.RandomFromSlice([]int8{0, 0, 1, 2}))).at(span))
+		default:
+			switch g.rand.Intn(4) {
+			case 0:
+				played = m.then(m.at(span))
+			case 1:
+				played = m.then(m.transpose(int(g.RandomFromSlice([]int8{-2, -1, 1, 2}))).at(span))
+			case 2:
+				played = m.then(m.invert().at(span))
+			default:
+				played = m.augment()
+			}
+		}
+
+		last := g.melodyBarEvents(idea, played, base, tune)
+		if end {
+			idx := rng.fit(scale, cadence(scale, last, bar == idea.Bars-1))
+			tune[span] = BarEvent{
+				[]uint8{scale.Key(idx, 0)},
+				uint32(steps-span) * clock.Ticks16th(),
+				g.RandMidiRange(85, 100),
+				0,
+			}
+		}
+
+		articulate(tune, idea.Articulation)
+		if bar == idea.Bars-1 {
+			holdLast(tune)
+		}
+		tracks[bar] = BarTracks{tune}
+	}
+	return tracks
+}
+
+// how often each note of a chord is landed on, as thirds up from the root
+// of the chord
+var chordTonePrefs = []int8{
+	0, 0, 0, 0, // root
+	1, 1, 1, 1, 1, // 3rd
+	2, 2, 2, // 5th
+}
+
+// sevenths are landed on as often as the fifth
+var seventhTonePrefs = []int8{3, 3, 3}
+
+// chordToneTracks builds a melody over the progression in the idea. The
+// strong beats (and chord changes) land on a chord tone close to the last
+// note. The weak beats in between pass by step towards the next chord tone,
+// or step off and back as a neighbour tone when there is nowhere to go
+func (g *Generator) chordToneTracks(idea Idea) []BarTracks {
+	harmony := idea.Scale
+	scale := melodyScale(idea)
+	prog := idea.Progression
+	steps := idea.Meter.Steps()
+	pulse := idea.Meter.BiasPulse()
+	rng := melodyRange(idea)
+
+	tracks := make([]BarTracks, idea.Bars)
+	last := rng.fit(scale, scale.Nearest(harmony.Root(prog.At(0, 0, steps), 0)))
+	for bar := 0; bar < idea.Bars; bar++ {
+		var tune = make([]BarEvent, steps)
+		for i := range tune {
+			tune[i] = BarEvent{[]uint8{0}, clock.Ticks16th(), 0, 0}
+		}
+
+		t := idea.Swing.Grid(g.GenerateRhythm(pulse))
+		var hits []int
+		strong := make([]bool, steps)
+		for i := 0; i < steps; i++ {
+			strong[i] = pulse[i] || prog.ChangesAt(i, steps)
+			if t[i] || strong[i] {
+				hits = append(hits, i)
+			}
+		}
+
+		// land the strong beats first so the weak beats know where they
+		// are heading
+		notes := make([]int, steps)
+		for _, i := range hits {
+			if !strong[i] {
+				continue
+			}
+			chord := prog.At(bar, i, steps)
+			prefs := chordTonePrefs
+			if chord.Seventh {
+				prefs = append(append([]int8{}, chordTonePrefs...), seventhTonePrefs...)
+			}
+			// only the chord tones the melody's scale has, so a chord from
+			// outside the key (like a tritone sub) is met on the notes it
+			// shares with the melody
+			var playable []int8
+			for _, tone := range prefs {
+				if scale.Has(harmony.ChordTone(chord, int(tone), 0)) {
+					playable = append(playable, tone)
+				}
+			}
+			if len(playable) > 0 {
+				prefs = playable
+			}
+			tone := harmony.ChordTone(chord, int(g.RandomFromSlice(prefs)), 0)
+
+			// the chord tone closest to the last note, then the note of the
+			// melody's scale closest to that
+			key := nearestKey(scale.Key(last, 0), tone)
+			last = rng.fit(scale, scale.Nearest(key))
+			notes[i] = last
+		}
+
+		prev := -1
+		for h, i := range hits {
+			if strong[i] {
+				prev = notes[i]
+				continue
+			}
+			if prev < 0 {
+				prev = last
+			}
+			next := prev
+			for _, j := range hits[h+1:] {
+				if strong[j] {
+					next = notes[j]
+					break
+				}
+			}
+
+			switch {
+			case next-prev >= 2:
+				notes[i] = prev + 1
+			case prev-next >= 2:
+				notes[i] = prev - 1
+			case g.rand.Intn(3) == 0:
+				notes[i] = prev - 1
+			default:
+				notes[i] = prev + 1
+			}
+			// at the edge of the range step the other way instead
+			if key := scale.Key(notes[i], 0); key < rng.Low || key > rng.High {
+				notes[i] = 2*prev - notes[i]
+			}
+			prev = notes[i]
+		}
+
+		for h, i := range hits {
+			length := steps - i
+			if h+1 < len(hits) {
+				length = hits[h+1] - i
+			}
+			velocity := g.RandMidiRange(70, 90)
+			if strong[i] {
+				velocity = g.RandMidiRange(90, 110)
+			}
+			tune[i] = BarEvent{
+				[]uint8{scale.Key(notes[i], 0)},
+				uint32(length) * clock.Ticks16th(),
+				velocity,
+				0,
+			}
+		}
+
+		articulate(tune, idea.Articulation)
+		if bar == idea.Bars-1 {
+			holdLast(tune)
+		}
+		tracks[bar] = BarTracks{tune}
+	}
+	return tracks
+}
@@ -0,0 +1,185 @@
+package songmatic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Meter a time signature, for example 3/4 is Meter{3, 4}
+type Meter struct {
+	Beats uint8
+	Value uint8
+}
+
+var (
+	Meter44  = Meter{4, 4}
+	Meter34  = Meter{3, 4}
+	Meter54  = Meter{5, 4}
+	Meter68  = Meter{6, 8}
+	Meter78  = Meter{7, 8}
+	Meter128 = Meter{12, 8}
+)
+
+// Where the kick and snare like to land in each meter, as 16th note steps
+// from the start of the bar
+type meterAccents struct {
+	pulses []int
+	kick   []int
+	snare  []int
+}
+
+var meters = map[Meter]meterAccents{
+	// 1 e + a 2 e + a 3 e + a 4 e + a
+	// K       S       K       S
+	Meter44: {[]int{0, 4, 8, 12}, []int{0, 8}, []int{4, 12}},
+	// 1 e + a 2 e + a 3 e + a
+	// K       S       S
+	Meter34: {[]int{0, 4, 8}, []int{0}, []int{4, 8}},
+	// 1 e + a 2 e + a 3 e + a 4 e + a 5 e + a
+	// K               S       K       S
+	Meter54: {[]int{0, 4, 8, 12, 16}, []int{0, 12}, []int{8, 16}},
+	// 1 + 2 + 3 + 4 + 5 + 6 +
+	// K           S
+	Meter68: {[]int{0, 6}, []int{0}, []int{6}},
+	// 1 + 2 + 3 + 4 + 5 + 6 + 7 +  (2+2+3)
+	// K       S       K
+	Meter78: {[]int{0, 4, 8}, []int{0, 8}, []int{4}},
+	// 1 + 2 + 3 + 4 + 5 + 6 + 7 + 8 + 9 + 10+ 11+ 12+
+	// K           S           K           S
+	Meter128: {[]int{0, 6, 12, 18}, []int{0, 12}, []int{6, 18}},
+}
+
+// ParseMeter reads a time signature like "6/8". Only the meters we know
+// how to play are allowed
+func ParseMeter(text string) (Meter, error) {
+	beats, value, ok := strings.Cut(strings.TrimSpace(text), "/")
+	b, err := strconv.ParseUint(beats, 10, 8)
+	if !ok || err != nil {
+		return Meter44, fmt.Errorf("unknown meter: %v", text)
+	}
+	v, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return Meter44, fmt.Errorf("unknown meter: %v", text)
+	}
+	m := Meter{uint8(b), uint8(v)}
+	if _, ok := meters[m]; !ok {
+		return Meter44, fmt.Errorf("unsupported meter: %v", text)
+	}
+	return m, nil
+}
+
+func (m Meter) String() string {
+	return fmt.Sprintf("%d/%d", m.Beats, m.Value)
+}
+
+// Steps the number of 16th notes in one bar
+func (m Meter) Steps() int {
+	return int(m.Beats) * 16 / int(m.Value)
+}
+
+// Compound true for meters felt in dotted quarters (6/8, 12/8)
+func (m Meter) Compound() bool {
+	return m.Value == 8 && m.Beats%3 == 0
+}
+
+// ClocksPerClick midi clocks (24 to a quarter note) between metronome
+// clicks. Compound meters click on the dotted quarter, other x/8 meters on
+// the 8th note
+func (m Meter) ClocksPerClick() uint8 {
+	if m.Compound() {
+		return 36
+	}
+	if m.Value == 8 {
+		return 12
+	}
+	return 24
+}
+
+// Pulses the steps where the felt beats of the bar land
+func (m Meter) Pulses() []int {
+	return meters[m].pulses
+}
+
+func (m Meter) rhythm(steps ...int) Rhythm {
+	r := make(Rhythm, m.Steps())
+	for _, s := range steps {
+		r[s] = true
+	}
+	return r
+}
+
+// BiasNone nothing is forced on
+func (m Meter) BiasNone() Rhythm {
+	return m.rhythm()
+}
+
+// BiasOne the downbeat of the bar
+func (m Meter) BiasOne() Rhythm {
+	return m.rhythm(0)
+}
+
+// BiasKick the strong beats of the bar (1 & 3 in 4/4)
+func (m Meter) BiasKick() Rhythm {
+	return m.rhythm(meters[m].kick...)
+}
+
+// BiasSnare the back beats of the bar (2 & 4 in 4/4)
+func (m Meter) BiasSnare() Rhythm {
+	return m.rhythm(meters[m].snare...)
+}
+
+// BiasPulse every felt beat of the bar (quarters in 4/4, dotted quarters
+// in 6/8)
+func (m Meter) BiasPulse() Rhythm {
+	return m.rhythm(m.Pulses()...)
+}
+
+// BiasCount every counted beat of the bar (quarters in 4/4, 8ths in 6/8)
+func (m Meter) BiasCount() Rhythm {
+	every := 16 / int(m.Value)
+	var steps []int
+	for s := 0; s < m.Steps(); s += every {
+		steps = append(steps, s)
+	}
+	return m.rhythm(steps...)
+}
+
+// Rhythm which 16th note steps of a bar have something happening on them
+type Rhythm []bool
+
+// GenerateRhythm makes a random rhythm that always has the steps in bias on
+func (g *Generator) GenerateRhythm(bias Rhythm) Rhythm {
+	beat := make(Rhythm, len(bias))
+	for i := range beat {
+		beat[i] = bias[i] || g.rand.Intn(2) == 1
+	}
+	return beat
+}
+
+// stepLevel how strong a step of the bar is, from 0 where the kick lands,
+// 1 on the back beats, 2 on the other pulses, 3 on the rest of the 8ths
+// and 4 on the 16ths in between
+func (m Meter) stepLevel(step int) int {
+	accents := meters[m]
+	switch {
+	case containsStep(accents.kick, step):
+		return 0
+	case containsStep(accents.snare, step):
+		return 1
+	case containsStep(accents.pulses, step):
+		return 2
+	case step%2 == 0:
+		return 3
+	}
+	return 4
+}
+
+func containsStep(steps []int, step int) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
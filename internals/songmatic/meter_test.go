@@ -0,0 +1,17 @@
+package songmatic
+
+import "testing"
+
+func TestParseMeter(t *testing.T) {
+	for text, want := range map[string]Meter{"4/4": Meter44, " 6/8 ": Meter68, "12/8": Meter128} {
+		if m, err := ParseMeter(text); err != nil || m != want {
+			t.Errorf("%q: want %v, got %v (%v)", text, want, m, err)
+		}
+	}
+
+	for _, text := range []string{"", "4", "4/", "/4", "4/4x", "4/4/4", "4 /4", "+4/4", "4/-4", "2/2", "260/4"} {
+		if m, err := ParseMeter(text); err == nil {
+			t.Errorf("%q: want an error, got %v", text, m)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package songmatic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Pitch a note with its spelling kept, so Bb and A# are different pitches
+// even though they are the same midi key. Octaves are scientific pitch
+// notation, where middle C (midi 60) is C4
+type Pitch struct {
+	// the white key name, 'A' to 'G'
+	Letter byte
+	// -2 is a double flat, -1 flat, 0 natural, 1 sharp and 2 double sharp
+	Accidental int8
+	Octave     int8
+}
+
+// semitones above C for each letter
+var letterSemitones = map[byte]int{
+	'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11,
+}
+
+// letters in the order they go up an octave from C
+const letterOrder = "CDEFGAB"
+
+// sharp and flat spellings for each midi key in an octave starting on C
+var (
+	sharpSpelling = [12]Pitch{
+		{'C', 0, 0}, {'C', 1, 0}, {'D', 0, 0}, {'D', 1, 0}, {'E', 0, 0}, {'F', 0, 0},
+		{'F', 1, 0}, {'G', 0, 0}, {'G', 1, 0}, {'A', 0, 0}, {'A', 1, 0}, {'B', 0, 0},
+	}
+	flatSpelling = [12]Pitch{
+		{'C', 0, 0}, {'D', -1, 0}, {'D', 0, 0}, {'E', -1, 0}, {'E', 0, 0}, {'F', 0, 0},
+		{'G', -1, 0}, {'G', 0, 0}, {'A', -1, 0}, {'A', 0, 0}, {'B', -1, 0}, {'B', 0, 0},
+	}
+)
+
+// ParsePitch reads a pitch in scientific pitch notation, for example "C4",
+// "Bb2", "F#" or "Ebb3". Double sharps can be written "##" or "x". Without
+// an octave the pitch is in octave 4
+func ParsePitch(text string) (Pitch, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Pitch{}, fmt.Errorf("no pitch given")
+	}
+
+	p := Pitch{Letter: strings.ToUpper(text[:1])[0], Octave: 4}
+	if _, ok := letterSemitones[p.Letter]; !ok {
+		return Pitch{}, fmt.Errorf("unknown note name: %v", text)
+	}
+
+	i := 1
+accidentals:
+	for ; i < len(text); i++ {
+		switch text[i] {
+		case '#':
+			p.Accidental++
+		case 'x':
+			p.Accidental += 2
+		case 'b':
+			p.Accidental--
+		default:
+			break accidentals
+		}
+	}
+	if p.Accidental < -2 || p.Accidental > 2 {
+		return Pitch{}, fmt.Errorf("too many accidentals: %v", text)
+	}
+
+	rest := text[i:]
+	if rest != "" {
+		octave, err := strconv.Atoi(rest)
+		if err != nil || octave < -1 || octave > 9 {
+			return Pitch{}, fmt.Errorf("unknown octave: %v", text)
+		}
+		p.Octave = int8(octave)
+	}
+
+	if _, err := p.Midi(); err != nil {
+		return Pitch{}, err
+	}
+	return p, nil
+}
+
+// PitchFromMidi the pitch of a midi key, spelt with flats or sharps
+func PitchFromMidi(key uint8, useFlats bool) Pitch {
+	p := sharpSpelling[key%12]
+	if useFlats {
+		p = flatSpelling[key%12]
+	}
+	p.Octave = int8(key/12) - 1
+	return p
+}
+
+// Midi the midi key of the pitch, or an error if it is outside 0 to 127.
+// Spellings that cross an octave are kept in their octave, so B#3 and C4
+// are both 60
+func (p Pitch) Midi() (uint8, error) {
+	key := p.semitones()
+	if key < 0 || key > 127 {
+		return 0, fmt.Errorf("pitch is outside the midi range: %v", p)
+	}
+	return uint8(key), nil
+}
+
+// Key the midi key of the pitch, moved whole octaves into the midi range
+// if it is outside it
+func (p Pitch) Key() uint8 {
+	key := p.semitones()
+	for key > 127 {
+		key -= 12
+	}
+	for key < 0 {
+		key += 12
+	}
+	return uint8(key)
+}
+
+func (p Pitch) semitones() int {
+	return 12*(int(p.Octave)+1) + letterSemitones[p.Letter] + int(p.Accidental)
+}
+
+// Transpose moves the pitch up (or down) by semitones. The new pitch is
+// spelt with flats if this one is flat, and sharps otherwise
+func (p Pitch) Transpose(semitones int) (Pitch, error) {
+	key := p.semitones() + semitones
+	if key < 0 || key > 127 {
+		return p, fmt.Errorf("can not move %v by %d, it is outside the midi range", p, semitones)
+	}
+	return PitchFromMidi(uint8(key), p.Accidental < 0), nil
+}
+
+// TransposeOctaves moves the pitch up (or down) whole octaves keeping its
+// spelling
+func (p Pitch) TransposeOctaves(octaves int) (Pitch, error) {
+	octave := int(p.Octave) + octaves
+	t := Pitch{p.Letter, p.Accidental, int8(octave)}
+	if _, err := t.Midi(); err != nil || octave < -1 || octave > 9 {
+		return p, fmt.Errorf("can not move %v by %d octaves, it is outside the midi range", p, octaves)
+	}
+	return t, nil
+}
+
+// Name the note name without its octave, for example "Bb" or "F##"
+func (p Pitch) Name() string {
+	if p.Letter == 0 {
+		return ""
+	}
+	acc := ""
+	switch {
+	case p.Accidental > 0:
+		acc = strings.Repeat("#", int(p.Accidental))
+	case p.Accidental < 0:
+		acc = strings.Repeat("b", int(-p.Accidental))
+	}
+	return string(p.Letter) + acc
+}
+
+func (p Pitch) String() string {
+	return fmt.Sprintf("%s%d", p.Name(), p.Octave)
+}
+
+// ascending puts the notes of a scale into octaves so each one is above
+// the one before it, starting from the first note in octave
+func ascending(notes []Pitch, octave int8) []Pitch {
+	notes[0].Octave = octave
+	for i := 1; i < len(notes); i++ {
+		notes[i].Octave = notes[i-1].Octave
+		if strings.IndexByte(letterOrder, notes[i].Letter) <= strings.IndexByte(letterOrder, notes[i-1].Letter) {
+			notes[i].Octave++
+		}
+	}
+	return notes
+}
@@ -0,0 +1,96 @@
+package songmatic
+
+import "testing"
+
+func TestParsePitch(t *testing.T) {
+	tests := []struct {
+		text string
+		name string
+		midi uint8
+	}{
+		{"C4", "C4", 60},
+		{"c", "C4", 60},
+		{"Bb2", "Bb2", 46},
+		{"F#", "F#4", 66},
+		{"Ebb3", "Ebb3", 50},
+		{"Cx4", "C##4", 62},
+		{"C##4", "C##4", 62},
+		{"B#3", "B#3", 60},
+		{"Cb4", "Cb4", 59},
+		{"C-1", "C-1", 0},
+		{"G9", "G9", 127},
+	}
+	for _, tt := range tests {
+		p, err := ParsePitch(tt.text)
+		if err != nil {
+			t.Errorf("%v: %v", tt.text, err)
+			continue
+		}
+		if p.String() != tt.name {
+			t.Errorf("%v: want %v, got %v", tt.text, tt.name, p)
+		}
+		midi, err := p.Midi()
+		if err != nil || midi != tt.midi {
+			t.Errorf("%v: want midi %d, got %d (%v)", tt.text, tt.midi, midi, err)
+		}
+		again, err := ParsePitch(p.String())
+		if err != nil || again != p {
+			t.Errorf("%v: %v read back as %v (%v)", tt.text, p, again, err)
+		}
+	}
+
+	for _, text := range []string{"", "H4", "C###4", "Dbbb2", "C10", "G#9", "Cb-1", "C4x"} {
+		if p, err := ParsePitch(text); err == nil {
+			t.Errorf("%q: want an error, got %v", text, p)
+		}
+	}
+}
+
+func TestPitchFromMidi(t *testing.T) {
+	for key := 0; key < 128; key++ {
+		for _, flats := range []bool{false, true} {
+			p := PitchFromMidi(uint8(key), flats)
+			if midi, err := p.Midi(); err != nil || midi != uint8(key) {
+				t.Fatalf("%d: %v is midi %d (%v)", key, p, midi, err)
+			}
+			if flats && p.Accidental > 0 || !flats && p.Accidental < 0 {
+				t.Fatalf("%d: %v is spelt the wrong way", key, p)
+			}
+			again, err := ParsePitch(p.String())
+			if err != nil || again != p {
+				t.Fatalf("%d: %v read back as %v (%v)", key, p, again, err)
+			}
+		}
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	bb, _ := ParsePitch("Bb2")
+	if p, err := bb.Transpose(3); err != nil || p.String() != "Db3" {
+		t.Errorf("Bb2 up 3: want Db3, got %v (%v)", p, err)
+	}
+	fs, _ := ParsePitch("F#4")
+	if p, err := fs.Transpose(-2); err != nil || p.String() != "E4" {
+		t.Errorf("F#4 down 2: want E4, got %v (%v)", p, err)
+	}
+	cx, _ := ParsePitch("Cx4")
+	if p, err := cx.TransposeOctaves(-2); err != nil || p.String() != "C##2" {
+		t.Errorf("C##4 down 2 octaves: want C##2, got %v (%v)", p, err)
+	}
+
+	low, _ := ParsePitch("C-1")
+	if p, err := low.Transpose(-1); err == nil {
+		t.Errorf("C-1 down 1: want an error, got %v", p)
+	}
+	high, _ := ParsePitch("G9")
+	if p, err := high.Transpose(1); err == nil {
+		t.Errorf("G9 up 1: want an error, got %v", p)
+	}
+	if p, err := high.TransposeOctaves(1); err == nil {
+		t.Errorf("G9 up an octave: want an error, got %v", p)
+	}
+	a, _ := ParsePitch("A8")
+	if p, err := a.TransposeOctaves(1); err == nil {
+		t.Errorf("A8 up an octave: want an error, got %v", p)
+	}
+}
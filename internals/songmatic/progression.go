@@ -0,0 +1,421 @@
+package songmatic
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chord a chord built by stacking thirds on a degree of the scale
+type Chord struct {
+	// 0 based degree of the scale the chord is built on (0 = I)
+	Degree  int
+	Seventh bool
+	// 9, 11 and 13 stacked above the seventh from the scale. Ones that
+	// clash with the chord (an 11 over a major third) are left out
+	Tensions []int
+	// altered tensions as semitones above the root, 13 is a b9
+	Altered []int
+	// played as the dominant seventh a tritone away, so V7 becomes bII7
+	TritoneSub bool
+}
+
+// how a chord is extended, with the tensions each one stacks up. The
+// longer names come first so "13" is not read as "1"
+var extensions = []struct {
+	name     string
+	tensions []int
+}{
+	{"13", []int{9, 11, 13}},
+	{"11", []int{9, 11}},
+	{"9", []int{9}},
+	{"7", nil},
+}
+
+// the altered tensions and how many semitones above the root they are
+var alterations = []struct {
+	name      string
+	semitones int
+}{
+	{"b9", 13},
+	{"#9", 15},
+	{"#11", 18},
+	{"b13", 20},
+}
+
+// Progression a list of chords played in order, PerBar chords in each bar.
+// If there are more bars than chords the progression repeats
+type Progression struct {
+	Chords []Chord
+	PerBar int
+}
+
+// A progression we like, and how often we want to pick it compared to the
+// others. Degrees are 0 based (0 = I, 4 = V)
+type progressionTemplate struct {
+	weight  int
+	degrees []int
+}
+
+var progressionTemplates = []progressionTemplate{
+	{5, []int{0, 4, 5, 3}}, // I  V  vi IV
+	{4, []int{0, 5, 3, 4}}, // I  vi IV V
+	{3, []int{1, 4, 0, 0}}, // ii V  I  I
+	{3, []int{5, 3, 0, 4}}, // vi IV I  V
+	{2, []int{0, 3, 4, 3}}, // I  IV V  IV
+	{2, []int{0, 3, 5, 4}}, // I  IV vi V
+	{1, []int{0, 2, 3, 4}}, // I  iii IV V
+	{1, []int{1, 4, 2, 5}}, // ii V  iii vi
+}
+
+var numerals = [7]string{"I", "II", "III", "IV", "V", "VI", "VII"}
+
+// RandomProgression picks one of the progression templates, weighted
+// towards the more common ones, changing chord perBar times a bar
+func (g *Generator) RandomProgression(perBar int, jazz bool) Progression {
+	total := 0
+	for _, t := range progressionTemplates {
+		total += t.weight
+	}
+
+	pick := g.rand.Intn(total)
+	tmpl := progressionTemplates[0]
+	for _, t := range progressionTemplates {
+		if pick < t.weight {
+			tmpl = t
+			break
+		}
+		pick -= t.weight
+	}
+
+	prog := Progression{PerBar: perBar}
+	for _, d := range tmpl.degrees {
+		prog.Chords = append(prog.Chords, Chord{Degree: d, Seventh: jazz})
+	}
+	return prog
+}
+
+// ParseProgression reads a progression written in Roman numerals separated
+// by dashes, commas or spaces, for example "I-V-vi-IV" or "ii7 V7 I". The
+// chord quality always comes from the scale, so "ii" and "II" are the same.
+// A trailing 7 adds the seventh, and a 9, 11 or 13 stacks tensions up to
+// that one. Altered tensions come after ("V7b9#11") and "sub" in front plays
+// the tritone substitute ("subV7")
+func ParseProgression(text string, perBar int) (Progression, error) {
+	prog := Progression{PerBar: perBar}
+
+	fields := strings.FieldsFunc(text, func(r rune) bool {
+		return r == '-' || r == ',' || r == ' '
+	})
+
+	for _, f := range fields {
+		chord, err := parseChord(f)
+		if err != nil {
+			return prog, err
+		}
+		prog.Chords = append(prog.Chords, chord)
+	}
+
+	if len(prog.Chords) == 0 {
+		return prog, fmt.Errorf("no chords in progression: %v", text)
+	}
+	return prog, nil
+}
+
+func parseChord(text string) (Chord, error) {
+	c := Chord{Degree: -1}
+	rest := text
+	if strings.HasPrefix(strings.ToLower(rest), "sub") {
+		c.TritoneSub = true
+		rest = rest[3:]
+	}
+
+	n := 0
+	for n < len(rest) && strings.IndexByte("IViv", rest[n]) >= 0 {
+		n++
+	}
+	name := strings.ToUpper(rest[:n])
+	for d, num := range numerals {
+		if name == num {
+			c.Degree = d
+		}
+	}
+	if c.Degree < 0 {
+		return c, fmt.Errorf("unknown chord numeral: %v", text)
+	}
+	rest = strings.TrimLeft(rest[n:], "°oOøØhH+")
+
+	for _, e := range extensions {
+		if strings.HasPrefix(rest, e.name) {
+			c.Seventh = true
+			c.Tensions = append([]int{}, e.tensions...)
+			rest = rest[len(e.name):]
+			break
+		}
+	}
+
+	for rest != "" {
+		found := false
+		for _, a := range alterations {
+			if strings.HasPrefix(rest, a.name) {
+				c.Seventh = true
+				c.Altered = append(c.Altered, a.semitones)
+				rest = rest[len(a.name):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return c, fmt.Errorf("unknown chord numeral: %v", text)
+		}
+	}
+	if c.TritoneSub {
+		c.Seventh = true
+	}
+	return c, nil
+}
+
+// At the chord that is playing on a 16th note step of a bar with steps
+// 16th notes in it
+func (p Progression) At(bar int, step int, steps int) Chord {
+	if len(p.Chords) == 0 {
+		return Chord{}
+	}
+	slot := bar*p.perBar() + step*p.perBar()/steps
+	return p.Chords[slot%len(p.Chords)]
+}
+
+// ChangesAt true if a new chord starts on a 16th note step of a bar with
+// steps 16th notes in it
+func (p Progression) ChangesAt(step int, steps int) bool {
+	if step == 0 {
+		return true
+	}
+	return p.ChangesBetween(step-1, step, steps)
+}
+
+// ChangesBetween true if a new chord starts after the step from, up to and
+// including the step to
+func (p Progression) ChangesBetween(from int, to int, steps int) bool {
+	return from*p.perBar()/steps != to*p.perBar()/steps
+}
+
+func (p Progression) perBar() int {
+	if p.PerBar < 1 {
+		return 1
+	}
+	return p.PerBar
+}
+
+// Numerals the progression as Roman numerals in the scale, for example
+// "I-V-vi-IV"
+func (p Progression) Numerals(scale Scale) string {
+	names := make([]string, len(p.Chords))
+	for i, c := range p.Chords {
+		names[i] = scale.Numeral(c)
+	}
+	return strings.Join(names, "-")
+}
+
+// Symbols the chord symbols of the progression in the scale, for example
+// ["C", "G", "Am", "F"]
+func (p Progression) Symbols(scale Scale) []string {
+	names := make([]string, len(p.Chords))
+	for i, c := range p.Chords {
+		names[i] = scale.Symbol(c)
+	}
+	return names
+}
+
+// Key the midi key of a note in the scale. idx can go past the end of the
+// scale (or below zero) to move up (or down) octaves from the tonic
+func (s Scale) Key(idx int, octave int8) uint8 {
+	n := len(s.Notes)
+	oct := idx / n
+	pos := idx % n
+	if pos < 0 {
+		pos += n
+		oct--
+	}
+
+	note := s.Notes[pos]
+	note.Octave += int8(oct) + octave
+	return note.Key()
+}
+
+// ChordKeys the midi keys of a chord as stacked thirds from its root, then
+// its tensions and altered tensions. A tritone substitute is always a
+// dominant seventh
+func (s Scale) ChordKeys(c Chord, octave int8) []uint8 {
+	root := int(s.Root(c, octave))
+
+	var keys []uint8
+	if c.TritoneSub {
+		for _, t := range []int{0, 4, 7, 10} {
+			keys = append(keys, midiKey(root+t))
+		}
+	} else {
+		size := 3
+		if c.Seventh {
+			size = 4
+		}
+		for i := 0; i < size; i++ {
+			keys = append(keys, s.Key(c.Degree+2*i, octave))
+		}
+		for _, t := range s.tensions(c) {
+			keys = append(keys, s.Key(c.Degree+t-1, octave))
+		}
+	}
+
+	for _, a := range c.Altered {
+		keys = append(keys, midiKey(root+a))
+	}
+	return keys
+}
+
+// ChordTone the midi key of a note of a chord counted up in thirds, 0 is
+// the root, 1 the third, 2 the fifth and 3 the seventh. The notes of a
+// tritone substitute are those of its dominant seventh, not of the scale
+func (s Scale) ChordTone(c Chord, n int, octave int8) uint8 {
+	if c.TritoneSub {
+		return midiKey(int(s.Root(c, octave)) + []int{0, 4, 7, 10}[n%4])
+	}
+	return s.Key(c.Degree+2*n, octave)
+}
+
+// Root the midi key of the root of a chord. A tritone substitute goes down
+// a tritone from its degree so it stays close to where it was
+func (s Scale) Root(c Chord, octave int8) uint8 {
+	root := s.Key(c.Degree, octave)
+	if !c.TritoneSub {
+		return root
+	}
+	if root >= 6 {
+		return root - 6
+	}
+	return root + 6
+}
+
+// tensions the tensions of a chord that can be played over it. A 9 that is
+// a b9 in the scale, an 11 over a major third and a 13 that is a b13 all
+// clash, and a tension is left out when an altered one takes its place
+func (s Scale) tensions(c Chord) []int {
+	third := s.semitones(c.Degree+2) - s.semitones(c.Degree)
+
+	var valid []int
+	for _, t := range c.Tensions {
+		interval := s.semitones(c.Degree+t-1) - s.semitones(c.Degree)
+		switch t {
+		case 9:
+			if interval != 14 || c.altered(13) || c.altered(15) {
+				continue
+			}
+		case 11:
+			if third == 4 || interval != 17 || c.altered(18) {
+				continue
+			}
+		case 13:
+			if interval != 21 || c.altered(20) {
+				continue
+			}
+		default:
+			continue
+		}
+		valid = append(valid, t)
+	}
+	return valid
+}
+
+func (c Chord) altered(semitones int) bool {
+	for _, a := range c.Altered {
+		if a == semitones {
+			return true
+		}
+	}
+	return false
+}
+
+// alterationNames the altered tensions of a chord, for example "b9#11"
+func (c Chord) alterationNames() string {
+	name := ""
+	for _, a := range c.Altered {
+		for _, alt := range alterations {
+			if alt.semitones == a {
+				name += alt.name
+			}
+		}
+	}
+	return name
+}
+
+// midiKey a key moved whole octaves into the midi range
+func midiKey(key int) uint8 {
+	for key > 127 {
+		key -= 12
+	}
+	for key < 0 {
+		key += 12
+	}
+	return uint8(key)
+}
+
+// Numeral the Roman numeral of a chord in the scale, lower case for minor
+// and diminished chords, with its highest tension and any altered ones
+func (s Scale) Numeral(c Chord) string {
+	if c.TritoneSub {
+		return "sub" + numerals[c.Degree] + "7" + c.alterationNames()
+	}
+
+	_, triads, _ := ScaleDegrees(s.Mode)
+
+	name := numerals[c.Degree]
+	if triads[c.Degree] != "M" {
+		name = strings.ToLower(name)
+	}
+	if triads[c.Degree] == "°" {
+		// with its seventh the diminished triad is half diminished
+		if c.Seventh {
+			name += "ø"
+		} else {
+			name += "°"
+		}
+	}
+	if c.Seventh {
+		name += s.extension(c)
+	}
+	return name + c.alterationNames()
+}
+
+// extension the number written after a chord, 7 or its highest tension
+func (s Scale) extension(c Chord) string {
+	if t := s.tensions(c); len(t) > 0 {
+		return fmt.Sprint(t[len(t)-1])
+	}
+	return "7"
+}
+
+// Symbol the chord symbol of a chord in the scale, for example "Am", "G7"
+// or "G13(b9)"
+func (s Scale) Symbol(c Chord) string {
+	alt := ""
+	if names := c.alterationNames(); names != "" {
+		alt = "(" + names + ")"
+	}
+	if c.TritoneSub {
+		return PitchFromMidi(s.Root(c, 0), true).Name() + "7" + alt
+	}
+
+	_, triads, sevenths := ScaleDegrees(s.Mode)
+
+	root := s.Notes[c.Degree].Name()
+	if c.Seventh {
+		return root + strings.TrimSuffix(sevenths[c.Degree], "7") + s.extension(c) + alt
+	}
+
+	switch triads[c.Degree] {
+	case "m":
+		return root + "m" + alt
+	case "°":
+		return root + "°" + alt
+	}
+	return root + alt
+}
@@ -0,0 +1,143 @@
+package songmatic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScaleFormula a scale written as degrees of the major scale, for example
+// "1 2 b3 4 5 b6 7" for harmonic minor. The degrees also give the spelling,
+// so the b5 of the blues scale is a flat fifth and never a sharp fourth
+type ScaleFormula struct {
+	Name    string
+	Degrees string
+}
+
+var scaleFormulas = []ScaleFormula{
+	{"major", "1 2 3 4 5 6 7"},
+	{"minor", "1 2 b3 4 5 b6 b7"},
+	{"harmonicminor", "1 2 b3 4 5 b6 7"},
+	{"melodicminor", "1 2 b3 4 5 6 7"},
+	{"majorpentatonic", "1 2 3 5 6"},
+	{"minorpentatonic", "1 b3 4 5 b7"},
+	{"blues", "1 b3 4 b5 5 b7"},
+	{"majorblues", "1 2 b3 3 5 6"},
+	{"wholetone", "1 2 3 #4 #5 b7"},
+	{"diminished", "1 2 b3 4 #4 #5 6 7"},
+	{"phrygiandominant", "1 b2 3 4 5 b6 b7"},
+	{"hungarianminor", "1 2 b3 #4 5 b6 7"},
+	{"doubleharmonic", "1 b2 3 4 5 b6 7"},
+	{"hirajoshi", "1 2 b3 5 b6"},
+	{"insen", "1 b2 4 5 b7"},
+}
+
+// semitones above the tonic for each degree of the major scale
+var majorSemitones = [7]int{0, 2, 4, 5, 7, 9, 11}
+
+// ParseScaleFormula finds a scale formula by name
+func ParseScaleFormula(name string) (ScaleFormula, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, f := range scaleFormulas {
+		if name == f.Name {
+			return f, nil
+		}
+	}
+	return ScaleFormula{}, fmt.Errorf("unknown scale: %v", name)
+}
+
+// ScaleFormulaNames the names of all the scale formulas
+func ScaleFormulaNames() []string {
+	names := make([]string, len(scaleFormulas))
+	for i, f := range scaleFormulas {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// NewScale builds the scale of a formula going up from tonic. The scale
+// can have any number of notes, and has no key signature of its own
+func NewScale(tonic Pitch, formula ScaleFormula) (Scale, error) {
+	start := strings.IndexByte(letterOrder, tonic.Letter)
+	if start < 0 {
+		return Scale{}, fmt.Errorf("unknown tonic: %v", tonic)
+	}
+
+	var scale Scale
+	for _, f := range strings.Fields(formula.Degrees) {
+		num := strings.TrimLeft(f, "b#")
+		acc := strings.Count(f[:len(f)-len(num)], "#") - strings.Count(f[:len(f)-len(num)], "b")
+		deg, err := strconv.Atoi(num)
+		if err != nil || deg < 1 || deg > 7 {
+			return Scale{}, fmt.Errorf("unknown degree %v in scale %v", f, formula.Name)
+		}
+
+		letter := start + deg - 1
+		note := Pitch{letterOrder[letter%7], 0, tonic.Octave + int8(letter/7)}
+		want := tonic.semitones() + majorSemitones[deg-1] + acc
+		note.Accidental = int8(want - note.semitones())
+		if note.Accidental < -2 || note.Accidental > 2 {
+			return Scale{}, fmt.Errorf("can not spell %v of %v from %v", f, formula.Name, tonic)
+		}
+		if note.Accidental < 0 {
+			scale.UseFlats = true
+		}
+		scale.Notes = append(scale.Notes, note)
+	}
+
+	if len(scale.Notes) == 0 {
+		return Scale{}, fmt.Errorf("no notes in scale: %v", formula.Name)
+	}
+	return scale, nil
+}
+
+// Nearest the scale index in octave 0 or around it of the note closest to a
+// midi key, going down when two are as close
+func (s Scale) Nearest(key uint8) int {
+	n := len(s.Notes)
+	best, dist := 0, 128
+	for idx := -6 * n; idx < 6*n; idx++ {
+		d := abs(s.semitones(idx) - int(key))
+		if d < dist {
+			best, dist = idx, d
+		}
+	}
+	return best
+}
+
+// Has true if the note name of key is one of the notes of the scale
+func (s Scale) Has(key uint8) bool {
+	for idx := range s.Notes {
+		if int(s.Key(idx, 0))%12 == int(key)%12 {
+			return true
+		}
+	}
+	return false
+}
+
+// semitones the midi number of a note in the scale without folding it into
+// the midi range
+func (s Scale) semitones(idx int) int {
+	n := len(s.Notes)
+	oct := idx / n
+	pos := idx % n
+	if pos < 0 {
+		pos += n
+		oct--
+	}
+	return s.Notes[pos].semitones() + 12*oct
+}
+
+// stable the scale indexes in the first octave that a phrase can rest on,
+// the tonic and anything a third or a fifth above it
+func (s Scale) stable() []int {
+	tonic := s.Notes[0].semitones()
+	var idx []int
+	for i, n := range s.Notes {
+		switch n.semitones() - tonic {
+		case 0, 3, 4, 7:
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
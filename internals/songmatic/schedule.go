@@ -0,0 +1,100 @@
+package songmatic
+
+import (
+	"sort"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// scheduled a NoteOn or NoteOff at the tick it happens on from the start of
+// the track. note is which note it belongs to, and rank keeps the NoteOffs
+// of earlier notes before the NoteOns on the same tick
+type scheduled struct {
+	tick uint32
+	rank int
+	note int
+	on   bool
+	key  uint8
+	msg  midi.Message
+}
+
+// schedule collects the notes of one channel at absolute ticks, and then
+// writes them to a track as deltas. It only does work for the notes it is
+// given, however long the track is
+type schedule struct {
+	ch    uint8
+	end   uint32
+	notes int
+	msgs  []scheduled
+}
+
+// newSchedule a schedule for a channel that must end on the tick end
+func newSchedule(ch uint8, end uint32) *schedule {
+	return &schedule{ch: ch, end: end}
+}
+
+// note plays key from the tick start until the tick off. A note that ends
+// where it starts (like a drum hit) is let go straight after it is played,
+// and one held past the end of the track is let go at the end
+func (s *schedule) note(start uint32, off uint32, key uint8, velocity uint8) {
+	if key == 0 || velocity == 0 || start >= s.end {
+		return
+	}
+	rank := 0
+	if off > s.end {
+		off = s.end
+	}
+	if off <= start {
+		off, rank = start, 2
+	}
+
+	s.notes++
+	s.msgs = append(s.msgs,
+		scheduled{start, 1, s.notes, true, key, midi.NoteOn(s.ch, key, velocity)},
+		scheduled{off, rank, s.notes, false, key, midi.NoteOff(s.ch, key)},
+	)
+}
+
+// write sorts everything by tick and adds it to the track. Returns how many
+// ticks are left from the last event to the end
+func (s *schedule) write(tr *smf.Track) uint32 {
+	sort.SliceStable(s.msgs, func(i, j int) bool {
+		if s.msgs[i].tick != s.msgs[j].tick {
+			return s.msgs[i].tick < s.msgs[j].tick
+		}
+		return s.msgs[i].rank < s.msgs[j].rank
+	})
+
+	// because delta time, now is the tick of the last thing we put on the
+	// track, and every event is added as an offset from there. A key
+	// played again while it is still held is let go first, and then the
+	// NoteOff of the note it cut short is dropped so it can't end the new one
+	var now uint32
+	sounding := map[uint8]int{}
+	cut := map[int]bool{}
+	for _, m := range s.msgs {
+		if m.on {
+			if held, ok := sounding[m.key]; ok {
+				tr.Add(m.tick-now, midi.NoteOff(s.ch, m.key))
+				now = m.tick
+				cut[held] = true
+			}
+			sounding[m.key] = m.note
+		} else {
+			if cut[m.note] {
+				continue
+			}
+			if sounding[m.key] == m.note {
+				delete(sounding, m.key)
+			}
+		}
+		tr.Add(m.tick-now, m.msg)
+		now = m.tick
+	}
+
+	if s.end > now {
+		return s.end - now
+	}
+	return 0
+}
@@ -0,0 +1,277 @@
+package songmatic
+
+import (
+	"bytes"
+	"testing"
+
+	"gitlab.com/gomidi/midi/v2/gm"
+	"gitlab.com/gomidi/midi/v2/smf"
+)
+
+// note a note read back from a track, with absolute ticks
+type readNote struct {
+	ch    uint8
+	key   uint8
+	start int64
+	end   int64
+}
+
+// readTrack reads the notes of a track back and checks every NoteOn is
+// ended once, there are no messages for key 0 and nothing is left held.
+// Returns the notes and the tick the track ends on
+func readTrack(t *testing.T, tr smf.Track) ([]readNote, int64) {
+	t.Helper()
+	var notes []readNote
+	held := map[[2]uint8]int{}
+	var tick int64
+	for _, ev := range tr {
+		tick += int64(ev.Delta)
+		var ch, key, velocity uint8
+		switch {
+		case ev.Message.GetNoteStart(&ch, &key, &velocity):
+			if key == 0 {
+				t.Fatalf("NoteOn for key 0 at %d", tick)
+			}
+			if _, ok := held[[2]uint8{ch, key}]; ok {
+				t.Fatalf("key %d played again at %d while still held", key, tick)
+			}
+			held[[2]uint8{ch, key}] = len(notes)
+			notes = append(notes, readNote{ch, key, tick, -1})
+		case ev.Message.GetNoteEnd(&ch, &key):
+			if key == 0 {
+				t.Fatalf("NoteOff for key 0 at %d", tick)
+			}
+			i, ok := held[[2]uint8{ch, key}]
+			if !ok {
+				t.Fatalf("NoteOff for key %d at %d that isn't held", key, tick)
+			}
+			notes[i].end = tick
+			delete(held, [2]uint8{ch, key})
+		}
+	}
+	if len(held) > 0 {
+		t.Fatalf("%d notes still held at the end of the track", len(held))
+	}
+	return notes, tick
+}
+
+func testIdea(meter Meter, swing Swing) Idea {
+	scale, _ := GenerateScale(0, Ionian)
+	prog, _ := ParseProgression("I vi IV V", 1)
+	return Idea{
+		Tempo:       120,
+		Scale:       scale,
+		Meter:       meter,
+		Swing:       swing,
+		Bars:        4,
+		Progression: prog,
+		Humanize: map[Part]Humanize{
+			PartChords: DefaultHumanize(1),
+			PartDrums:  DefaultHumanize(1),
+			PartBass:   DefaultHumanize(1),
+			PartMelody: DefaultHumanize(1),
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, meter := range []Meter{Meter44, Meter34, Meter68, Meter78} {
+		for _, swing := range []Swing{Straight, Shuffle} {
+			idea := testIdea(meter, swing)
+			end := int64(idea.Bars) * int64(meter.Steps()) * int64(clock.Ticks16th())
+			for seed := int64(1); seed <= 5; seed++ {
+				g := NewGenerator(seed)
+				parts := map[string][]byte{
+					"chords": g.RandomChords(idea),
+					"drums":  g.RandomBeat(idea),
+					"bass":   g.RandomBass(idea),
+					"melody": g.RandomMelody(idea),
+					"arp":    g.RandomArp(idea),
+					"song":   g.RandomSong(idea),
+				}
+				for name, b := range parts {
+					s, err := smf.ReadFrom(bytes.NewReader(b))
+					if err != nil {
+						t.Fatalf("%v %v %v: %v", meter, swing, name, err)
+					}
+					if name == "song" && len(s.Tracks) != 5 {
+						t.Fatalf("%v %v song: want 5 tracks, got %d", meter, swing, len(s.Tracks))
+					}
+					if name != "song" && len(s.Tracks) != 1 {
+						t.Fatalf("%v %v %v: want 1 track, got %d", meter, swing, name, len(s.Tracks))
+					}
+
+					played := 0
+					for i, tr := range s.Tracks {
+						notes, last := readTrack(t, tr)
+						played += len(notes)
+						if name == "song" && i == 0 {
+							continue
+						}
+						if last != end {
+							t.Fatalf("%v %v %v: track %d ends on %d, want %d", meter, swing, name, i, last, end)
+						}
+					}
+					if played == 0 {
+						t.Fatalf("%v %v %v: no notes", meter, swing, name)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestScheduleOverlap(t *testing.T) {
+	idea := testIdea(Meter44, Straight)
+	idea.Bars = 1
+	rest := BarEvent{[]uint8{0}, Sixteenth, 0, 0}
+	events := make(BarEvents, 16)
+	for i := range events {
+		events[i] = rest
+	}
+	// a whole note on C, played again on beat 3 while it is still held,
+	// and a legato E that runs past the end of the bar
+	events[0] = BarEvent{[]uint8{60}, Whole, 100, 0}
+	events[8] = BarEvent{[]uint8{60, 64}, Half, 90, 0}
+	events[12] = BarEvent{[]uint8{64}, Legato.Hold(Quarter), 90, 0}
+	snippet := SongSnippet{Tracks: []BarTracks{{events}}, Channel: 0, Instr: gm.Instr_AcousticGrandPiano}
+
+	s, err := smf.ReadFrom(bytes.NewReader(mkSMF(idea, snippet)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, last := readTrack(t, s.Tracks[0])
+	want := []readNote{
+		{0, 60, 0, 960},
+		{0, 60, 960, 1920},
+		{0, 64, 960, 1440},
+		{0, 64, 1440, 1920},
+	}
+	if len(notes) != len(want) {
+		t.Fatalf("want %d notes, got %d: %v", len(want), len(notes), notes)
+	}
+	for i := range want {
+		if notes[i] != want[i] {
+			t.Errorf("note %d: want %v, got %v", i, want[i], notes[i])
+		}
+	}
+	if last != 1920 {
+		t.Errorf("track ends on %d, want 1920", last)
+	}
+}
+
+func TestScheduleEarlyAndDrums(t *testing.T) {
+	idea := testIdea(Meter44, Straight)
+	idea.Bars = 2
+	rest := BarEvent{[]uint8{0}, Sixteenth, 0, 0}
+	bar := func() BarEvents {
+		events := make(BarEvents, 16)
+		for i := range events {
+			events[i] = rest
+		}
+		return events
+	}
+
+	// a note pushed early on the downbeat of the second bar lands in the
+	// first bar, before the note on the last step of the first bar
+	first, second := bar(), bar()
+	first[15] = BarEvent{[]uint8{gm.DrumKey_ClosedHiHat.Key()}, Sixteenth, 80, 0}
+	second[0] = BarEvent{[]uint8{gm.DrumKey_AcousticBassDrum.Key()}, Sixteenth, 100, -200}
+	snippet := SongSnippet{Tracks: []BarTracks{{first}, {second}}, Channel: 9, Instr: gm.Instr_AcousticGrandPiano}
+
+	s, err := smf.ReadFrom(bytes.NewReader(mkSMF(idea, snippet)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, last := readTrack(t, s.Tracks[0])
+	want := []readNote{
+		{9, gm.DrumKey_AcousticBassDrum.Key(), 1720, 1720},
+		{9, gm.DrumKey_ClosedHiHat.Key(), 1800, 1800},
+	}
+	if len(notes) != len(want) {
+		t.Fatalf("want %d notes, got %d: %v", len(want), len(notes), notes)
+	}
+	for i := range want {
+		if notes[i] != want[i] {
+			t.Errorf("note %d: want %v, got %v", i, want[i], notes[i])
+		}
+	}
+	if last != 3840 {
+		t.Errorf("track ends on %d, want 3840", last)
+	}
+}
+
+func TestScheduleRests(t *testing.T) {
+	idea := testIdea(Meter34, Straight)
+	idea.Bars = 3
+	events := make(BarEvents, 12)
+	for i := range events {
+		events[i] = BarEvent{[]uint8{0}, Sixteenth, 0, 0}
+	}
+	snippet := SongSnippet{Tracks: []BarTracks{{events}, {events}, {events}}, Channel: 1, Instr: gm.Instr_AcousticBass}
+
+	s, err := smf.ReadFrom(bytes.NewReader(mkSMF(idea, snippet)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, last := readTrack(t, s.Tracks[0])
+	if len(notes) != 0 {
+		t.Errorf("want no notes, got %v", notes)
+	}
+	if last != 3*12*120 {
+		t.Errorf("track ends on %d, want %d", last, 3*12*120)
+	}
+}
+
+func TestScheduleOrder(t *testing.T) {
+	// added out of order: a note ending on the tick the next one starts, a
+	// drum style hit that ends where it starts, and a key played again
+	// while it is still held
+	s := newSchedule(0, 960)
+	s.note(480, 720, 64, 90)
+	s.note(0, 480, 60, 100)
+	s.note(480, 480, 67, 80)
+	s.note(240, 960, 60, 70)
+
+	var tr smf.Track
+	left := s.write(&tr)
+	if left != 0 {
+		t.Errorf("want 0 ticks left, got %d", left)
+	}
+
+	type msg struct {
+		delta uint32
+		on    bool
+		key   uint8
+	}
+	want := []msg{
+		{0, true, 60},
+		// played again on 240, so the first C is let go there and its own
+		// NoteOff on 480 is dropped
+		{240, false, 60},
+		{0, true, 60},
+		{240, true, 64},
+		{0, true, 67},
+		{0, false, 67},
+		{240, false, 64},
+		{240, false, 60},
+	}
+	if len(tr) != len(want) {
+		t.Fatalf("want %d messages, got %d: %v", len(want), len(tr), tr)
+	}
+	for i, ev := range tr {
+		var ch, key, velocity uint8
+		got := msg{delta: ev.Delta}
+		switch {
+		case ev.Message.GetNoteStart(&ch, &key, &velocity):
+			got.on, got.key = true, key
+		case ev.Message.GetNoteEnd(&ch, &key):
+			got.key = key
+		default:
+			t.Fatalf("message %d is not a note: %v", i, ev.Message)
+		}
+		if got != want[i] {
+			t.Errorf("message %d: want %v, got %v", i, want[i], got)
+		}
+	}
+}
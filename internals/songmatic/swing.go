@@ -0,0 +1,110 @@
+package songmatic
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Swing how late the off-beat 8ths (or 16ths) are played. An Amount of
+// 0.5 is straight, 0.66 is a triplet feel and 0.75 is a dotted feel
+type Swing struct {
+	Amount float64
+	// the note that is swung in 16th note steps, 2 for 8ths, 1 for 16ths
+	Unit int
+	// drums and bass only play on the 8th note grid so the swing becomes a
+	// triplet shuffle
+	Shuffle bool
+}
+
+var (
+	Straight = Swing{0.5, 2, false}
+	Shuffle  = Swing{2.0 / 3.0, 2, true}
+)
+
+// ParseSwing reads a swing amount as a percentage from 50 to 75, which
+// swings 8ths ("60") unless 16ths are asked for ("60/16"). "shuffle" gives
+// a triplet shuffle
+func ParseSwing(text string) (Swing, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+	switch text {
+	case "", "straight":
+		return Straight, nil
+	case "shuffle", "triplet":
+		return Shuffle, nil
+	}
+
+	amount, note := text, "8"
+	if i := strings.Index(text, "/"); i >= 0 {
+		amount, note = text[:i], text[i+1:]
+	}
+
+	var percent float64
+	if _, err := fmt.Sscanf(amount, "%g", &percent); err != nil {
+		return Straight, fmt.Errorf("unknown swing: %v", text)
+	}
+	if percent < 50 || percent > 75 {
+		return Straight, fmt.Errorf("swing must be between 50 and 75: %v", text)
+	}
+
+	swing := Swing{percent / 100, 2, false}
+	switch note {
+	case "8":
+		swing.Unit = 2
+	case "16":
+		swing.Unit = 1
+	default:
+		return Straight, fmt.Errorf("can only swing 8ths or 16ths: %v", text)
+	}
+	return swing, nil
+}
+
+func (s Swing) String() string {
+	if s.Shuffle {
+		return "shuffle"
+	}
+	if s.Amount <= 0.5 {
+		return "straight"
+	}
+	note := 8
+	if s.Unit == 1 {
+		note = 16
+	}
+	return fmt.Sprintf("%v/%d", math.Round(s.Amount*100), note)
+}
+
+// Tick moves a tick within a bar to where it is played with swing. Each
+// pair of swung notes is stretched so the first takes Amount of the pair
+// and the second takes the rest
+func (s Swing) Tick(pos uint32) uint32 {
+	unit := uint32(s.Unit) * clock.Ticks16th()
+	if s.Amount <= 0.5 || unit == 0 {
+		return pos
+	}
+
+	pair := 2 * unit
+	start := pos - pos%pair
+	p := float64(pos % pair)
+	on := s.Amount * float64(pair)
+
+	var t float64
+	if p < float64(unit) {
+		t = p * on / float64(unit)
+	} else {
+		t = on + (p-float64(unit))*(float64(pair)-on)/float64(unit)
+	}
+	return start + uint32(math.Round(t))
+}
+
+// Grid takes out the 16th notes of a rhythm when playing a shuffle, so
+// only the 8th notes are left
+func (s Swing) Grid(r Rhythm) Rhythm {
+	if !s.Shuffle {
+		return r
+	}
+	grid := make(Rhythm, len(r))
+	for i := 0; i < len(r); i += 2 {
+		grid[i] = r[i]
+	}
+	return grid
+}
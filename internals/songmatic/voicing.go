@@ -0,0 +1,262 @@
+package songmatic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VoicingStyle how the notes of a chord are spread out when they are played
+type VoicingStyle int
+
+const (
+	// Close voicings in the middle of the keyboard, comped in a rhythm
+	VoicingPiano VoicingStyle = 0
+	// Wide open voicings held for as long as the chord lasts
+	VoicingPad VoicingStyle = 1
+	// Root on the bottom shapes like the ones played on a guitar
+	VoicingGuitar VoicingStyle = 2
+)
+
+var voicingStyleNames = [3]string{"piano", "pad", "guitar"}
+
+func (v VoicingStyle) String() string {
+	if v < VoicingPiano || v > VoicingGuitar {
+		return fmt.Sprintf("voicing%d", int(v))
+	}
+	return voicingStyleNames[v]
+}
+
+// ParseVoicingStyle turns a style name ("pad") or number ("1") into a
+// VoicingStyle
+func ParseVoicingStyle(name string) (VoicingStyle, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, n := range voicingStyleNames {
+		if name == n || name == fmt.Sprintf("%d", i) {
+			return VoicingStyle(i), nil
+		}
+	}
+	return VoicingPiano, fmt.Errorf("unknown voicing style: %v", name)
+}
+
+// the range of midi keys a voicing style plays in, and where it likes to sit
+type register struct {
+	low    int
+	high   int
+	center int
+}
+
+var voicingRegisters = [3]register{
+	{52, 79, 64}, // piano
+	{45, 84, 62}, // pad
+	{40, 76, 55}, // guitar
+}
+
+// below this key two notes closer than a fourth sound muddy
+const lowIntervalLimit = 48
+
+// voicer picks a voicing for each chord that moves as little as it can
+// from the voicing before it
+type voicer struct {
+	style VoicingStyle
+	jazz  bool
+	last  []int
+}
+
+// voice the midi keys to play for a chord in the scale
+func (v *voicer) voice(scale Scale, c Chord) []uint8 {
+	reg := voicingRegisters[VoicingPiano]
+	if v.style >= VoicingPiano && v.style <= VoicingGuitar {
+		reg = voicingRegisters[v.style]
+	}
+
+	var best []int
+	bestCost := -1
+	for _, cand := range v.candidates(scale, c, reg) {
+		if cand[0] < reg.low || cand[len(cand)-1] > reg.high {
+			continue
+		}
+		if len(cand) > 1 && cand[0] < lowIntervalLimit && cand[1]-cand[0] < 5 {
+			continue
+		}
+		cost := v.cost(cand, reg)
+		if bestCost < 0 || cost < bestCost {
+			best, bestCost = cand, cost
+		}
+	}
+
+	// nothing fits the register, so fall back to the chord as written
+	if best == nil {
+		for _, k := range scale.ChordKeys(c, 0) {
+			best = append(best, int(k))
+		}
+	}
+
+	v.last = best
+	keys := make([]uint8, len(best))
+	for i, k := range best {
+		keys[i] = uint8(k)
+	}
+	return keys
+}
+
+// cost how far every voice moves from the last voicing, plus a little for
+// how far the voicing sits from the middle of the register
+func (v *voicer) cost(cand []int, reg register) int {
+	sum := 0
+	for _, k := range cand {
+		sum += k
+	}
+	cost := abs(sum/len(cand)-reg.center) / 2
+
+	if v.last == nil {
+		return cost
+	}
+	for _, k := range cand {
+		cost += nearestDistance(k, v.last)
+	}
+	for _, k := range v.last {
+		cost += nearestDistance(k, cand)
+	}
+	return cost
+}
+
+func nearestDistance(key int, keys []int) int {
+	best := 128
+	for _, k := range keys {
+		if d := abs(k - key); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// candidates all the voicings of a chord the style can play, in every
+// octave of the register. Each voicing is sorted from low to high
+func (v *voicer) candidates(scale Scale, c Chord, reg register) [][]int {
+	var tones []int
+	seen := map[int]bool{}
+	for _, k := range scale.ChordKeys(c, 0) {
+		if pc := int(k) % 12; !seen[pc] {
+			seen[pc] = true
+			tones = append(tones, pc)
+		}
+	}
+
+	// big chords leave out the fifth to make room for the tensions
+	if len(tones) > 5 && v.style != VoicingGuitar {
+		tones = append(append([]int{}, tones[:2]...), tones[3:]...)
+	}
+
+	var shapes [][]int
+	for inv := range tones {
+		closed := closeVoicing(tones, inv)
+		switch v.style {
+		case VoicingPad:
+			shapes = append(shapes, openVoicing(closed))
+		case VoicingGuitar:
+			if inv == 0 {
+				shapes = append(shapes, guitarShapes(closed)...)
+			}
+		default:
+			shapes = append(shapes, closed)
+		}
+
+		if v.jazz && len(closed) == 4 {
+			drop2, drop3 := dropVoicing(closed, 2), dropVoicing(closed, 3)
+			// on guitar drop voicings keep the root on the bottom string
+			if v.style != VoicingGuitar || drop3[0]%12 == tones[0] {
+				shapes = append(shapes, drop3)
+			}
+			if v.style != VoicingGuitar || drop2[0]%12 == tones[0] {
+				shapes = append(shapes, drop2)
+			}
+		}
+	}
+
+	var cands [][]int
+	for _, shape := range shapes {
+		for oct := reg.low/12 - 1; oct <= reg.high/12+1; oct++ {
+			cand := make([]int, len(shape))
+			for i, k := range shape {
+				cand[i] = k + 12*oct
+			}
+			cands = append(cands, cand)
+		}
+	}
+	return cands
+}
+
+// closeVoicing the chord tones stacked as tightly as they go from the
+// inversion inv, starting in octave 0
+func closeVoicing(tones []int, inv int) []int {
+	voicing := make([]int, len(tones))
+	for i := range tones {
+		k := tones[(i+inv)%len(tones)]
+		if i > 0 {
+			for k <= voicing[i-1] {
+				k += 12
+			}
+		}
+		voicing[i] = k
+	}
+	return voicing
+}
+
+// openVoicing spreads a close voicing by taking its second note up an octave
+func openVoicing(closed []int) []int {
+	if len(closed) < 3 {
+		return closed
+	}
+	open := append([]int{}, closed...)
+	open[1] += 12
+	sort.Ints(open)
+	return open
+}
+
+// dropVoicing takes the nth note from the top of a close voicing down an
+// octave, which gives the drop 2 and drop 3 voicings jazz players use
+func dropVoicing(closed []int, n int) []int {
+	drop := append([]int{}, closed...)
+	drop[len(drop)-n] -= 12
+	sort.Ints(drop)
+	return drop
+}
+
+// guitarShapes the root on the bottom shapes that fall under the fingers on
+// a guitar, with the root and fifth doubled an octave up
+func guitarShapes(closed []int) [][]int {
+	root := closed[0]
+	third := closed[1] - root
+	fifth := closed[2] - root
+
+	shapes := [][]int{
+		{0, fifth, 12, 12 + third, 12 + fifth, 24}, // E shape
+		{0, fifth, 12, 12 + third, 12 + fifth},     // A shape
+		{0, 12, 12 + fifth, 24 + third},            // spread triad
+	}
+	if len(closed) >= 4 {
+		seventh := closed[3] - root
+		shapes = [][]int{
+			{0, fifth, seventh, 12 + third, 12 + fifth},
+			{0, seventh, 12 + third, 12 + fifth},
+			{0, fifth, seventh, 12 + third},
+		}
+		// tensions go on top of the shape in place of the doubled fifth
+		if len(closed) > 4 {
+			shape := []int{0, seventh, 12 + third}
+			for _, t := range closed[4:] {
+				shape = append(shape, 12+(t-root)%12)
+			}
+			sort.Ints(shape)
+			shapes = append(shapes, shape)
+		}
+	}
+
+	for _, s := range shapes {
+		for i := range s {
+			s[i] += root
+		}
+	}
+	return shapes
+}
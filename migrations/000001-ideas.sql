@@ -0,0 +1,17 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE IF NOT EXISTS ideas (
+  uuid TEXT primary key,
+  owner TEXT NOT NULL,
+  name TEXT,
+  spec TEXT NOT NULL,
+  seed BIGINT NOT NULL,
+  created TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS ideas_owner ON ideas (owner, created);
+
+-- +migrate Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX ideas_owner;
+DROP TABLE ideas;
@@ -0,0 +1,30 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE IF NOT EXISTS blobs (
+  hash TEXT primary key,
+  data BYTEA NOT NULL,
+  size INTEGER NOT NULL,
+  created TIMESTAMP NOT NULL
+);
+
+ALTER TABLE ideas ADD COLUMN blob TEXT;
+
+-- +migrate Down
+-- SQL section 'Down' is executed when this migration is rolled back
+-- the table is made again without the blob column, as sqlite before 3.35
+-- can't drop a column
+CREATE TABLE ideas_rollback (
+  uuid TEXT primary key,
+  owner TEXT NOT NULL,
+  name TEXT,
+  spec TEXT NOT NULL,
+  seed BIGINT NOT NULL,
+  created TIMESTAMP NOT NULL
+);
+INSERT INTO ideas_rollback (uuid, owner, name, spec, seed, created)
+  SELECT uuid, owner, name, spec, seed, created FROM ideas;
+DROP TABLE ideas;
+ALTER TABLE ideas_rollback RENAME TO ideas;
+CREATE INDEX IF NOT EXISTS ideas_owner ON ideas (owner, created);
+
+DROP TABLE blobs;
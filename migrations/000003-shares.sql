@@ -0,0 +1,18 @@
+-- +migrate Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE IF NOT EXISTS shares (
+  token TEXT primary key,
+  idea TEXT NOT NULL,
+  owner TEXT NOT NULL,
+  blob TEXT,
+  created TIMESTAMP NOT NULL,
+  expires TIMESTAMP,
+  revoked TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS shares_owner ON shares (owner, created);
+
+-- +migrate Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX shares_owner;
+DROP TABLE shares;